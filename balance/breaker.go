@@ -0,0 +1,143 @@
+package balance
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 关闭，正常放行
+	BreakerOpen                         // 打开，拒绝请求
+	BreakerHalfOpen                     // 半开，放行少量探测请求
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerPolicy 熔断策略
+type BreakerPolicy struct {
+	FailureThreshold int64         // 连续失败多少次后打开
+	OpenTimeout      time.Duration // 打开多久后进入半开
+	HalfOpenRequests int64         // 半开时允许同时进行的探测请求数，<=0 时为1
+}
+
+var DefaultBreakerPolicy = BreakerPolicy{
+	FailureThreshold: 5,
+	OpenTimeout:      30 * time.Second,
+	HalfOpenRequests: 1,
+}
+
+// circuitBreaker 熔断器，由 ReportSuccess/ReportFailure 驱动状态变化
+type circuitBreaker struct {
+	policy BreakerPolicy
+
+	lock     sync.Mutex
+	state    BreakerState
+	failures int64     // 关闭状态下的连续失败次数
+	openedAt time.Time // 打开时间
+	probes   int64     // 半开状态下已放行的探测请求数
+}
+
+func newCircuitBreaker(policy BreakerPolicy) *circuitBreaker {
+	if policy.HalfOpenRequests <= 0 {
+		policy.HalfOpenRequests = 1
+	}
+	return &circuitBreaker{policy: policy}
+}
+
+// current 获取当前状态，打开超时后转为半开，调用方需持有锁
+func (b *circuitBreaker) current(now time.Time) BreakerState {
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.policy.OpenTimeout {
+		b.state = BreakerHalfOpen
+		b.probes = 0
+	}
+	return b.state
+}
+
+func (b *circuitBreaker) State() BreakerState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.current(time.Now())
+}
+
+// ready 是否允许请求，不占用探测名额
+func (b *circuitBreaker) ready() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.current(time.Now()) {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		return b.probes < b.policy.HalfOpenRequests
+	}
+	return true
+}
+
+// take 半开状态下占用一个探测名额
+func (b *circuitBreaker) take() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.current(time.Now()) == BreakerHalfOpen {
+		b.probes++
+	}
+}
+
+func (b *circuitBreaker) onSuccess() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.failures = 0
+	if b.current(time.Now()) == BreakerHalfOpen {
+		b.state = BreakerClosed
+	}
+}
+
+func (b *circuitBreaker) onFailure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	switch b.current(now) {
+	case BreakerHalfOpen:
+		b.open(now)
+	case BreakerClosed:
+		b.failures++
+		if b.policy.FailureThreshold > 0 && b.failures >= b.policy.FailureThreshold {
+			b.open(now)
+		}
+	}
+}
+
+func (b *circuitBreaker) open(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.failures = 0
+}
+
+// SetCircuitBreaker 为实例启用熔断器
+func (i *Instance) SetCircuitBreaker(policy BreakerPolicy) {
+	i.breaker.Store(newCircuitBreaker(policy))
+}
+
+func (i *Instance) circuitBreaker() *circuitBreaker {
+	b, _ := i.breaker.Load().(*circuitBreaker)
+	return b
+}
+
+// GetBreakerState 获取熔断器状态，未启用熔断器时为关闭
+func (i *Instance) GetBreakerState() BreakerState {
+	if b := i.circuitBreaker(); b != nil {
+		return b.State()
+	}
+	return BreakerClosed
+}
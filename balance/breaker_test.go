@@ -0,0 +1,147 @@
+package balance
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	inst := NewInstance("10.0.0.1", 80, 1)
+	inst.SetCircuitBreaker(BreakerPolicy{
+		FailureThreshold: 2,
+		OpenTimeout:      30 * time.Millisecond,
+		HalfOpenRequests: 1,
+	})
+
+	inst.ReportFailure()
+	if inst.GetBreakerState() != BreakerClosed {
+		t.Fatal("breaker opened too early")
+	}
+	inst.ReportFailure()
+	if inst.GetBreakerState() != BreakerOpen || inst.IsAvailable() {
+		t.Fatal("breaker should be open")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if inst.GetBreakerState() != BreakerHalfOpen || !inst.IsAvailable() {
+		t.Fatal("breaker should be half-open")
+	}
+	// 半开状态只放行一个探测请求
+	inst.markPicked()
+	if inst.IsAvailable() {
+		t.Fatal("half-open breaker allowed too many probes")
+	}
+	inst.ReportFailure()
+	if inst.GetBreakerState() != BreakerOpen {
+		t.Fatal("failed probe should reopen the breaker")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	inst.markPicked()
+	inst.ReportSuccess()
+	if inst.GetBreakerState() != BreakerClosed || !inst.IsAvailable() {
+		t.Fatal("successful probe should close the breaker")
+	}
+	if BreakerHalfOpen.String() != "half-open" {
+		t.Error(BreakerHalfOpen.String())
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	inst := NewInstance("10.0.0.1", 80, 1)
+	inst.SetRateLimit(1000, 2)
+	inst.markPicked()
+	if inst.IsRateLimited() {
+		t.Fatal("burst not allowed")
+	}
+	inst.markPicked()
+	if !inst.IsRateLimited() {
+		t.Fatal("bucket should be empty")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if inst.IsRateLimited() {
+		t.Fatal("bucket not refilled")
+	}
+
+	inst.SetRateLimit(0, 0)
+	for i := 0; i < 10; i++ {
+		inst.markPicked()
+	}
+	if inst.IsRateLimited() {
+		t.Error("rate limit not removed")
+	}
+}
+
+func TestBalancer_NoAvailableInstance(t *testing.T) {
+	for name, b := range newAllBalancers(t) {
+		list := newTestInstances(3)
+		list[0].SetCircuitBreaker(BreakerPolicy{FailureThreshold: 1, OpenTimeout: time.Hour})
+		list[0].ReportFailure()
+		list[1].SetRateLimit(0.001, 1)
+		list[1].markPicked()
+
+		for i := 0; i < 20; i++ {
+			inst, err := b.Pick(context.Background(), strconv.Itoa(i), list)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if inst != list[2] {
+				t.Fatalf("%s: picked unavailable instance %s", name, inst.GetAddr())
+			}
+		}
+
+		list[2].SetCircuitBreaker(BreakerPolicy{FailureThreshold: 1, OpenTimeout: time.Hour})
+		list[2].ReportFailure()
+		if _, err := b.Pick(context.Background(), "key", list); err != ErrNoAvailableInstance {
+			t.Errorf("%s: expected ErrNoAvailableInstance, got %v", name, err)
+		}
+		if _, err := b.Pick(context.Background(), "key", nil); err != ErrNoInstance {
+			t.Errorf("%s: expected ErrNoInstance, got %v", name, err)
+		}
+	}
+}
+
+func TestBalancer_UnhealthyNotUsedWhenHealthyLimited(t *testing.T) {
+	// 存在健康实例但都被限流时，不回退到不健康的实例
+	list := newTestInstances(2)
+	list[0].SetProbeResult(false)
+	list[1].SetRateLimit(0.001, 1)
+	list[1].markPicked()
+	for _, b := range []Balancer{&RoundRobinBalance{}, NewHashBalance(0), NewMaglevBalance(0)} {
+		if _, err := b.Pick(context.Background(), "key", list); err != ErrNoAvailableInstance {
+			t.Errorf("%T: expected ErrNoAvailableInstance, got %v", b, err)
+		}
+	}
+}
+
+func TestBalancer_RateLimitDraining(t *testing.T) {
+	// 令牌桶在过滤过程中被并发耗尽时，只能返回实例或 ErrNoAvailableInstance
+	for name, b := range newAllBalancers(t) {
+		list := newTestInstances(3)
+		for _, inst := range list {
+			inst.SetRateLimit(1000, 2)
+		}
+		var wg sync.WaitGroup
+		for g := 0; g < 16; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 5000; i++ {
+					inst, err := b.Pick(context.Background(), strconv.Itoa(g*1000+i), list)
+					if err != nil && err != ErrNoAvailableInstance {
+						t.Errorf("%s: unexpected error %v", name, err)
+						return
+					}
+					if err == nil && inst == nil {
+						t.Errorf("%s: nil instance without error", name)
+						return
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+	}
+}
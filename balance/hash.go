@@ -1,32 +1,181 @@
 package balance
 
 import (
-	"fmt"
+	"context"
 	"hash/crc32"
 	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
 )
 
-// 一致性hash算法
+const (
+	defaultReplicas = 160 // 每个实例默认的虚拟节点数
+)
+
+// 一致性hash算法，基于带虚拟节点的hash环
+// 相同的key总是落在同一个实例上，实例增减时只有约1/N的key会迁移
 type HashBalance struct {
+	Replicas int // 每个实例的虚拟节点数，<=0 时使用默认值
+
+	lock sync.Mutex
+	ring *hashRing
 }
 
 func init() {
-	RegisterBalancer("hash", &HashBalance{})
+	mustRegister("hash", func() Balancer {
+		return &HashBalance{}
+	})
+}
+
+// NewHashBalance 创建一致性hash负载均衡，replicas为每个实例的虚拟节点数
+func NewHashBalance(replicas int) *HashBalance {
+	return &HashBalance{Replicas: replicas}
 }
 
 func (p *HashBalance) DoBalance(instanceList []*Instance) (*Instance, error) {
-	var defKey = fmt.Sprintf("%d", rand.Int())
+	return p.Pick(context.Background(), "", instanceList)
+}
 
-	lens := len(instanceList)
-	if lens == 0 {
-		return nil, fmt.Errorf("no instance found")
+// Pick 根据key在hash环上选择实例，key为空时随机生成，等同于随机选择
+func (p *HashBalance) Pick(ctx context.Context, key string, instanceList []*Instance) (*Instance, error) {
+	if len(instanceList) == 0 {
+		return nil, ErrNoInstance
+	}
+	if key == "" {
+		key = strconv.Itoa(rand.Int())
 	}
 
-	crcTable := crc32.MakeTable(crc32.IEEE)
-	hashVal := crc32.Checksum([]byte(defKey), crcTable)
-	index := int(hashVal) % lens
-	inst := instanceList[index]
-	inst.CallNums++
+	p.lock.Lock()
+	if p.ring == nil || !p.ring.current(instanceList) {
+		p.ring = newHashRing(p.Replicas, instanceList)
+	}
+	inst, err := p.ring.get(key)
+	p.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	inst.markPicked()
 
 	return inst, nil
 }
+
+// OnUpdate 实例池变更时重建hash环
+func (p *HashBalance) OnUpdate(instanceList []*Instance) {
+	ring := newHashRing(p.Replicas, instanceList)
+	p.lock.Lock()
+	p.ring = ring
+	p.lock.Unlock()
+}
+
+type ringNode struct {
+	hash uint32
+	addr string
+}
+
+// memberSet 构建查找结构时的实例集合，实例列表不变时查找结构可以复用
+type memberSet struct {
+	members  map[string]*Instance // 实例地址 -> 实例
+	size     int                  // 构建时实例列表长度
+	snapshot []*Instance          // 构建时的实例列表，Pool 传入的是只读快照，再次传入同一快照时不需要比较
+}
+
+func newMemberSet(instanceList []*Instance) memberSet {
+	m := memberSet{
+		members:  make(map[string]*Instance, len(instanceList)),
+		size:     len(instanceList),
+		snapshot: instanceList,
+	}
+	for _, inst := range instanceList {
+		if _, ok := m.members[inst.GetAddr()]; !ok {
+			m.members[inst.GetAddr()] = inst
+		}
+	}
+	return m
+}
+
+// addrs 按地址排序的实例列表，保证相同实例集合构建出相同的查找结构
+func (m *memberSet) addrs() []string {
+	addrs := make([]string, 0, len(m.members))
+	for addr := range m.members {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// current 判断实例列表是否为构建时的快照，不是时再逐个比较，一致时记录为新的快照
+func (m *memberSet) current(instanceList []*Instance) bool {
+	if len(m.snapshot) > 0 && len(instanceList) == len(m.snapshot) && &instanceList[0] == &m.snapshot[0] {
+		return true
+	}
+	if !m.matches(instanceList) {
+		return false
+	}
+	m.snapshot = instanceList
+	return true
+}
+
+// matches 判断实例列表与构建时是否一致，与顺序无关
+// 地址相同但对象不同的实例直接替换，不需要重建
+func (m *memberSet) matches(instanceList []*Instance) bool {
+	if len(instanceList) != m.size {
+		return false
+	}
+	for _, inst := range instanceList {
+		addr := inst.GetAddr()
+		old, ok := m.members[addr]
+		if !ok {
+			return false
+		}
+		if old != inst {
+			m.members[addr] = inst
+		}
+	}
+	return true
+}
+
+// hashRing 一致性hash环，实例列表不变时复用
+type hashRing struct {
+	memberSet
+	nodes []ringNode // 按hash排序的虚拟节点
+}
+
+func newHashRing(replicas int, instanceList []*Instance) *hashRing {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	r := &hashRing{memberSet: newMemberSet(instanceList)}
+	r.nodes = make([]ringNode, 0, replicas*len(r.members))
+	for addr := range r.members {
+		for i := 0; i < replicas; i++ {
+			r.nodes = append(r.nodes, ringNode{
+				hash: hashKey(addr + "#" + strconv.Itoa(i)),
+				addr: addr,
+			})
+		}
+	}
+	sort.Slice(r.nodes, func(i, j int) bool {
+		if r.nodes[i].hash == r.nodes[j].hash {
+			return r.nodes[i].addr < r.nodes[j].addr
+		}
+		return r.nodes[i].hash < r.nodes[j].hash
+	})
+	return r
+}
+
+// get 顺时针查找第一个hash值不小于key的虚拟节点，跳过不健康或不可用的实例
+func (r *hashRing) get(key string) (*Instance, error) {
+	h := hashKey(key)
+	idx := sort.Search(len(r.nodes), func(i int) bool {
+		return r.nodes[i].hash >= h
+	})
+	return walkPick(len(r.nodes), len(r.members), func(i int) *Instance {
+		return r.members[r.nodes[(idx+i)%len(r.nodes)].addr]
+	})
+}
+
+func hashKey(key string) uint32 {
+	return crc32.ChecksumIEEE([]byte(key))
+}
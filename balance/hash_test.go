@@ -0,0 +1,144 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func newTestInstances(n int) []*Instance {
+	list := make([]*Instance, 0, n)
+	for i := 0; i < n; i++ {
+		list = append(list, NewInstance(fmt.Sprintf("10.0.0.%d", i+1), 8080, 1))
+	}
+	return list
+}
+
+func TestHashBalance_SameKey(t *testing.T) {
+	p := NewHashBalance(0)
+	list := newTestInstances(5)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		first, err := p.Pick(context.Background(), key, list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 3; j++ {
+			inst, _ := p.Pick(context.Background(), key, list)
+			if inst != first {
+				t.Fatalf("key %s moved from %s to %s", key, first.GetAddr(), inst.GetAddr())
+			}
+		}
+	}
+}
+
+func TestHashBalance_ReuseRing(t *testing.T) {
+	p := NewHashBalance(0)
+	list := newTestInstances(3)
+	_, _ = p.Pick(context.Background(), "a", list)
+	ring := p.ring
+
+	// 顺序变化不应重建hash环
+	reversed := []*Instance{list[2], list[1], list[0]}
+	_, _ = p.Pick(context.Background(), "b", reversed)
+	if p.ring != ring {
+		t.Error("ring rebuilt for the same instance set")
+	}
+
+	_, _ = p.Pick(context.Background(), "c", list[:2])
+	if p.ring == ring {
+		t.Error("ring not rebuilt after instance removed")
+	}
+}
+
+func TestHashBalance_Remove(t *testing.T) {
+	const (
+		n    = 10
+		keys = 10000
+	)
+	p := NewHashBalance(0)
+	list := newTestInstances(n)
+
+	before := make(map[string]string, keys)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("session-%d", i)
+		inst, _ := p.Pick(context.Background(), key, list)
+		before[key] = inst.GetAddr()
+	}
+
+	removed := list[3].GetAddr()
+	rest := append(append([]*Instance{}, list[:3]...), list[4:]...)
+	moved := 0
+	for key, addr := range before {
+		inst, _ := p.Pick(context.Background(), key, rest)
+		if inst.GetAddr() == removed {
+			t.Fatalf("key %s still mapped to removed instance", key)
+		}
+		if inst.GetAddr() != addr {
+			if addr != removed {
+				t.Fatalf("key %s moved between surviving instances", key)
+			}
+			moved++
+		}
+	}
+	ratio := float64(moved) / keys
+	if ratio > 2.0/n {
+		t.Errorf("moved %.3f of keys, expected about %.3f", ratio, 1.0/n)
+	}
+}
+
+func TestDoBalanceKey(t *testing.T) {
+	list := newTestInstances(4)
+	a, err := DoBalanceKey("hash", "tenant-1", list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := DoBalanceKey("hash", "tenant-1", list)
+	if a != b {
+		t.Error("same key picked different instances")
+	}
+	if _, err = DoBalanceKey("random", "tenant-1", list); err != nil {
+		t.Error(err)
+	}
+	if _, err = DoBalanceKey("none", "tenant-1", list); err == nil {
+		t.Error("expected error for unknown balancer")
+	}
+}
+
+func TestHashBalance_SnapshotPick(t *testing.T) {
+	p := NewHashBalance(0)
+	list := newTestInstances(3)
+	p.OnUpdate(list)
+	ring := p.ring
+
+	// OnUpdate 传入的快照不逐个比较，构建时长度不一致也复用hash环
+	ring.size = -1
+	if _, err := p.Pick(context.Background(), "a", list); err != nil {
+		t.Fatal(err)
+	}
+	if p.ring != ring {
+		t.Error("ring rebuilt for the observed snapshot")
+	}
+
+	copied := append([]*Instance(nil), list...)
+	_, _ = p.Pick(context.Background(), "b", copied)
+	if p.ring == ring {
+		t.Error("ring not checked for a different slice")
+	}
+}
+
+func TestHashBalance_StalePick(t *testing.T) {
+	p := NewHashBalance(0)
+	old, list := newTestInstances(3), newTestInstances(4)
+	p.OnUpdate(list)
+
+	// 持有旧快照的 Pick 与实例池更新并发时重建，之后新快照重建一次后恢复直接复用
+	_, _ = p.Pick(context.Background(), "a", old)
+	_, _ = p.Pick(context.Background(), "a", list)
+	ring := p.ring
+	ring.size = -1
+	_, _ = p.Pick(context.Background(), "b", list)
+	if p.ring != ring {
+		t.Error("ring rebuilt for the snapshot it was built from")
+	}
+}
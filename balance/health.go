@@ -0,0 +1,356 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OutlierPolicy 被动摘除策略，连续失败达到阈值后摘除实例，退避时长到期后自动恢复
+type OutlierPolicy struct {
+	ConsecutiveFailures int64         // 连续失败多少次后摘除
+	BaseEjection        time.Duration // 首次摘除时长，之后每次摘除翻倍
+	MaxEjection         time.Duration // 最大摘除时长
+}
+
+var DefaultOutlierPolicy = OutlierPolicy{
+	ConsecutiveFailures: 5,
+	BaseEjection:        10 * time.Second,
+	MaxEjection:         5 * time.Minute,
+}
+
+// SetOutlierPolicy 设置实例的被动摘除策略，未设置时使用 DefaultOutlierPolicy
+func (i *Instance) SetOutlierPolicy(policy OutlierPolicy) {
+	i.outlier.Store(&policy)
+}
+
+func (i *Instance) outlierPolicy() *OutlierPolicy {
+	if policy, ok := i.outlier.Load().(*OutlierPolicy); ok {
+		return policy
+	}
+	return &DefaultOutlierPolicy
+}
+
+// ReportSuccess 上报一次调用成功，清空连续失败次数，半开的熔断器关闭
+func (i *Instance) ReportSuccess() {
+	atomic.StoreInt64(&i.failures, 0)
+	atomic.StoreInt64(&i.ejections, 0)
+	if b := i.circuitBreaker(); b != nil {
+		b.onSuccess()
+	}
+}
+
+// ReportFailure 上报一次调用失败，连续失败达到阈值时摘除实例，并驱动熔断器
+func (i *Instance) ReportFailure() {
+	atomic.AddInt64(&i.failureTotal, 1)
+	if b := i.circuitBreaker(); b != nil {
+		b.onFailure()
+	}
+	policy := i.outlierPolicy()
+	if policy.ConsecutiveFailures <= 0 {
+		return
+	}
+	if atomic.AddInt64(&i.failures, 1) < policy.ConsecutiveFailures {
+		return
+	}
+	atomic.StoreInt64(&i.failures, 0)
+
+	// 摘除时长按摘除次数指数退避
+	n := atomic.AddInt64(&i.ejections, 1)
+	backoff := policy.BaseEjection
+	for ; n > 1 && backoff < policy.MaxEjection; n-- {
+		backoff *= 2
+	}
+	if policy.MaxEjection > 0 && backoff > policy.MaxEjection {
+		backoff = policy.MaxEjection
+	}
+	atomic.StoreInt64(&i.ejectedUntil, time.Now().Add(backoff).UnixNano())
+}
+
+// IsEjected 实例是否处于被动摘除状态
+func (i *Instance) IsEjected() bool {
+	return time.Now().UnixNano() < atomic.LoadInt64(&i.ejectedUntil)
+}
+
+// SetProbeResult 设置主动探测结果
+func (i *Instance) SetProbeResult(healthy bool) {
+	var failed int32
+	if !healthy {
+		failed = 1
+	}
+	atomic.StoreInt32(&i.probeFailed, failed)
+}
+
+// IsHealthy 主动探测通过且未被摘除
+func (i *Instance) IsHealthy() bool {
+	return atomic.LoadInt32(&i.probeFailed) == 0 && !i.IsEjected()
+}
+
+// healthyInstances 过滤不健康的实例，全部不健康时返回原列表
+// 每个实例只检查一次，探测结果、摘除状态并发变化时也不会返回空列表
+func healthyInstances(instanceList []*Instance) []*Instance {
+	var (
+		healthy  []*Instance
+		filtered bool
+	)
+	for i, inst := range instanceList {
+		if inst.IsHealthy() {
+			if filtered {
+				healthy = append(healthy, inst)
+			}
+			continue
+		}
+		if !filtered {
+			healthy = make([]*Instance, i, len(instanceList)-1)
+			copy(healthy, instanceList[:i])
+			filtered = true
+		}
+	}
+	if !filtered || len(healthy) == 0 {
+		return instanceList
+	}
+	return healthy
+}
+
+// availableInstances 过滤不健康的实例后，再过滤熔断器打开或令牌桶已空的实例，
+// 全部不可用时返回 ErrNoAvailableInstance
+// 每个实例只检查一次，令牌桶、熔断器并发变化时也不会返回空列表
+func availableInstances(instanceList []*Instance) ([]*Instance, error) {
+	instanceList = healthyInstances(instanceList)
+	var (
+		available []*Instance
+		filtered  bool
+	)
+	for i, inst := range instanceList {
+		if inst.IsAvailable() {
+			if filtered {
+				available = append(available, inst)
+			}
+			continue
+		}
+		if !filtered {
+			// 遇到第一个不可用的实例时才复制，全部可用时不分配内存
+			available = make([]*Instance, i, len(instanceList)-1)
+			copy(available, instanceList[:i])
+			filtered = true
+		}
+	}
+	if !filtered {
+		available = instanceList
+	}
+	if len(available) == 0 {
+		return nil, ErrNoAvailableInstance
+	}
+	return available, nil
+}
+
+// walkPick 按查找顺序选择实例，at(i) 返回第i个候选，total为不同实例的数量
+// 优先选择健康且可用的实例，全部不健康时选择第一个可用的实例，与 availableInstances 的规则一致
+func walkPick(n, total int, at func(i int) *Instance) (*Instance, error) {
+	first := at(0)
+	if first.IsHealthy() && first.IsAvailable() {
+		return first, nil
+	}
+
+	var (
+		fallback   *Instance // 第一个可用但不健康的实例
+		anyHealthy bool
+	)
+	checked := make(map[*Instance]struct{}, total)
+	for i := 0; i < n && len(checked) < total; i++ {
+		inst := at(i)
+		if _, ok := checked[inst]; ok {
+			continue
+		}
+		checked[inst] = struct{}{}
+
+		healthy, available := inst.IsHealthy(), inst.IsAvailable()
+		if healthy && available {
+			return inst, nil
+		}
+		anyHealthy = anyHealthy || healthy
+		if available && fallback == nil {
+			fallback = inst
+		}
+	}
+	if anyHealthy || fallback == nil {
+		return nil, ErrNoAvailableInstance
+	}
+	return fallback, nil
+}
+
+// Prober 主动探测
+type Prober interface {
+	Probe(ctx context.Context, inst *Instance) error
+}
+
+// TCPProber TCP连接探测
+type TCPProber struct {
+}
+
+func (p *TCPProber) Probe(ctx context.Context, inst *Instance) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", inst.GetAddr())
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// HTTPProber HTTP GET探测，状态码小于400视为健康
+type HTTPProber struct {
+	Path   string       // 探测路径，如 /health
+	Client *http.Client // 为空时使用 http.DefaultClient
+}
+
+func (p *HTTPProber) Probe(ctx context.Context, inst *Instance) error {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://"+inst.GetAddr()+p.Path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("probe %s failed, response code:%d", inst.GetAddr(), resp.StatusCode)
+	}
+	return nil
+}
+
+const (
+	defaultProbeInterval = 10 * time.Second // 默认探测间隔
+)
+
+// HealthChecker 定时对实例进行主动探测
+type HealthChecker struct {
+	Prober   Prober
+	Interval time.Duration // 探测间隔，<=0 时使用默认值
+	Timeout  time.Duration // 单次探测超时
+
+	lock      sync.Mutex
+	instances map[*Instance]struct{}
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewHealthChecker 创建主动探测，interval<=0 时使用默认探测间隔
+func NewHealthChecker(prober Prober, interval, timeout time.Duration) *HealthChecker {
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+	return &HealthChecker{
+		Prober:    prober,
+		Interval:  interval,
+		Timeout:   timeout,
+		instances: make(map[*Instance]struct{}),
+	}
+}
+
+// Add 添加需要探测的实例
+func (h *HealthChecker) Add(instanceList ...*Instance) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.instances == nil {
+		h.instances = make(map[*Instance]struct{})
+	}
+	for _, inst := range instanceList {
+		h.instances[inst] = struct{}{}
+	}
+}
+
+// Remove 移除实例，不再探测
+func (h *HealthChecker) Remove(instanceList ...*Instance) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, inst := range instanceList {
+		delete(h.instances, inst)
+	}
+}
+
+// Check 并发探测一轮所有实例，并更新实例的探测结果
+func (h *HealthChecker) Check(ctx context.Context) {
+	h.lock.Lock()
+	instanceList := make([]*Instance, 0, len(h.instances))
+	for inst := range h.instances {
+		instanceList = append(instanceList, inst)
+	}
+	h.lock.Unlock()
+
+	var wg sync.WaitGroup
+	for _, inst := range instanceList {
+		wg.Add(1)
+		go func(inst *Instance) {
+			defer wg.Done()
+			probeCtx := ctx
+			if h.Timeout > 0 {
+				var cancel context.CancelFunc
+				probeCtx, cancel = context.WithTimeout(ctx, h.Timeout)
+				defer cancel()
+			}
+			err := h.Prober.Probe(probeCtx, inst)
+			if ctx.Err() != nil {
+				// 探测被取消，结果不可信
+				return
+			}
+			inst.SetProbeResult(err == nil)
+		}(inst)
+	}
+	wg.Wait()
+}
+
+// Start 启动后台定时探测，重复调用无效
+func (h *HealthChecker) Start() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.done = make(chan struct{})
+	go h.run(ctx, h.done)
+}
+
+// Stop 停止后台探测
+func (h *HealthChecker) Stop() {
+	h.lock.Lock()
+	cancel, done := h.cancel, h.done
+	h.cancel, h.done = nil, nil
+	h.lock.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+func (h *HealthChecker) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	interval := h.Interval
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	h.Check(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.Check(ctx)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package balance
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInstance_Eject(t *testing.T) {
+	inst := NewInstance("10.0.0.1", 80, 1)
+	inst.SetOutlierPolicy(OutlierPolicy{
+		ConsecutiveFailures: 3,
+		BaseEjection:        50 * time.Millisecond,
+		MaxEjection:         time.Second,
+	})
+
+	inst.ReportFailure()
+	inst.ReportFailure()
+	inst.ReportSuccess()
+	inst.ReportFailure()
+	inst.ReportFailure()
+	if !inst.IsHealthy() {
+		t.Fatal("success should reset consecutive failures")
+	}
+
+	inst.ReportFailure()
+	if inst.IsHealthy() {
+		t.Fatal("instance should be ejected")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !inst.IsHealthy() {
+		t.Fatal("instance should come back after backoff")
+	}
+
+	// 再次摘除时退避时长翻倍
+	for i := 0; i < 3; i++ {
+		inst.ReportFailure()
+	}
+	time.Sleep(60 * time.Millisecond)
+	if inst.IsHealthy() {
+		t.Fatal("second ejection should last longer")
+	}
+}
+
+func TestBalancer_SkipUnhealthy(t *testing.T) {
+	for name, b := range newAllBalancers(t) {
+		list := newTestInstances(3)
+		list[0].SetProbeResult(false)
+		list[2].SetProbeResult(false)
+		for i := 0; i < 20; i++ {
+			inst, err := b.Pick(context.Background(), strconv.Itoa(i), list)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inst != list[1] {
+				t.Fatalf("%s: picked unhealthy instance %s", name, inst.GetAddr())
+			}
+		}
+
+		// 全部不健康时退化为使用完整列表
+		list[1].SetProbeResult(false)
+		if _, err := b.Pick(context.Background(), "key", list); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestHashBalance_SkipUnhealthy(t *testing.T) {
+	p := NewHashBalance(0)
+	list := newTestInstances(5)
+	before := make(map[string]*Instance)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		before[key], _ = p.Pick(context.Background(), key, list)
+	}
+
+	down := list[1]
+	down.SetProbeResult(false)
+	for key, inst := range before {
+		got, _ := p.Pick(context.Background(), key, list)
+		if inst != down && got != inst {
+			t.Fatalf("key %s moved from healthy instance", key)
+		}
+		if got == down {
+			t.Fatalf("key %s picked unhealthy instance", key)
+		}
+	}
+}
+
+func TestHealthChecker(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	p, _ := strconv.ParseInt(port, 10, 64)
+	up := NewInstance(host, p, 1)
+
+	// 获取一个没有监听的端口
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	_, port, _ = net.SplitHostPort(l.Addr().String())
+	l.Close()
+	p, _ = strconv.ParseInt(port, 10, 64)
+	down := NewInstance("127.0.0.1", p, 1)
+
+	tcp := NewHealthChecker(&TCPProber{}, time.Second, time.Second)
+	tcp.Add(up, down)
+	tcp.Check(context.Background())
+	if !up.IsHealthy() || down.IsHealthy() {
+		t.Fatal("unexpected tcp probe result")
+	}
+
+	down.SetProbeResult(true)
+	h := NewHealthChecker(&HTTPProber{Path: "/health"}, 10*time.Millisecond, time.Second)
+	h.Add(up, down)
+	h.Start()
+	time.Sleep(50 * time.Millisecond)
+	h.Stop()
+	if !up.IsHealthy() || down.IsHealthy() {
+		t.Fatal("unexpected http probe result")
+	}
+
+	h.Prober = &HTTPProber{Path: "/missing"}
+	h.Check(context.Background())
+	if up.IsHealthy() {
+		t.Error("non 2xx response should be unhealthy")
+	}
+}
+
+func TestHealthChecker_ZeroInterval(t *testing.T) {
+	h := NewHealthChecker(&TCPProber{}, 0, time.Second)
+	if h.Interval != defaultProbeInterval {
+		t.Errorf("unexpected interval %v", h.Interval)
+	}
+	h.Interval = 0
+	h.Start()
+	h.Stop()
+}
+
+func TestBalancer_HealthFlapping(t *testing.T) {
+	// 探测结果在过滤过程中并发变化时，不会返回空列表
+	for name, b := range newAllBalancers(t) {
+		list := newTestInstances(3)
+		list[1].SetProbeResult(false)
+		list[2].SetProbeResult(false)
+		stop := make(chan struct{})
+		flipped := make(chan struct{})
+		go func() {
+			defer close(flipped)
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				list[0].SetProbeResult(i%2 == 0)
+			}
+		}()
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 2000; i++ {
+					if _, err := b.Pick(context.Background(), strconv.Itoa(g*10000+i), list); err != nil {
+						t.Errorf("%s: unexpected error %v", name, err)
+						return
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+		close(stop)
+		<-flipped
+	}
+}
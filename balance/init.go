@@ -2,13 +2,34 @@ package balance
 
 import (
 	"fmt"
+	"sync/atomic"
 )
 
+// Instance 后端实例，Weight/CallNums 运行期间需通过原子操作访问
+// 原子访问的int64字段放在结构体开头，保证32位平台上8字节对齐
 type Instance struct {
 	Ip       string
 	Port     int64
 	Weight   int64
 	CallNums int64
+
+	inflight int64 // 正在处理的请求数
+	latency  int64 // EWMA延迟，纳秒
+
+	failureTotal int64                          // 累计失败次数
+	latencySum   int64                          // 累计耗时，纳秒
+	latencyHist  [len(latencyBuckets) + 1]int64 // 耗时直方图，最后一个为+Inf
+
+	failures     int64        // 连续失败次数
+	ejections    int64        // 连续摘除次数，用于计算退避时长
+	ejectedUntil int64        // 被动摘除截止时间，UnixNano
+	probeFailed  int32        // 主动探测失败为1
+	outlier      atomic.Value // *OutlierPolicy
+	limiter      atomic.Value // *tokenBucket
+	breaker      atomic.Value // *circuitBreaker
+
+	// Labels 实例元数据，如 zone，加入实例池后只读
+	Labels map[string]string
 }
 
 func NewInstance(ip string, port int64, w int64) *Instance {
@@ -20,6 +41,17 @@ func NewInstance(ip string, port int64, w int64) *Instance {
 	}
 }
 
+// WithLabels 设置实例元数据，需在实例投入使用前调用
+func (i *Instance) WithLabels(labels map[string]string) *Instance {
+	i.Labels = labels
+	return i
+}
+
+// GetLabel 获取元数据
+func (i *Instance) GetLabel(key string) string {
+	return i.Labels[key]
+}
+
 func (i *Instance) GetPort() int64 {
 	return i.Port
 }
@@ -32,10 +64,39 @@ func (i *Instance) GetAddr() string {
 	return fmt.Sprintf("%s:%d", i.Ip, i.Port)
 }
 
+// GetWeight 获取权重，并发安全
+func (i *Instance) GetWeight() int64 {
+	return atomic.LoadInt64(&i.Weight)
+}
+
+// SetWeight 运行期间调整权重，并发安全
+func (i *Instance) SetWeight(w int64) {
+	atomic.StoreInt64(&i.Weight, w)
+}
+
 func (i *Instance) GetCallTimes() int64 {
-	return i.CallNums
+	return atomic.LoadInt64(&i.CallNums)
 }
 
 func (i *Instance) GetResult() string {
-	return fmt.Sprintf("%s:%d;call nums:%d", i.Ip, i.Port, i.CallNums)
+	return fmt.Sprintf("%s:%d;call nums:%d", i.Ip, i.Port, i.GetCallTimes())
+}
+
+// markPicked 实例被选中，调用次数加一，并消耗限流令牌和熔断器半开探测名额
+func (i *Instance) markPicked() {
+	atomic.AddInt64(&i.CallNums, 1)
+	if b := i.rateLimiter(); b != nil {
+		b.take()
+	}
+	if b := i.circuitBreaker(); b != nil {
+		b.take()
+	}
+}
+
+// IsAvailable 熔断器未打开且令牌桶未空
+func (i *Instance) IsAvailable() bool {
+	if b := i.circuitBreaker(); b != nil && !b.ready() {
+		return false
+	}
+	return !i.IsRateLimited()
 }
@@ -0,0 +1,53 @@
+package balance
+
+import (
+	"context"
+	"math/rand"
+)
+
+// 最少连接算法，选择正在处理请求数最少的实例，数量相同时随机选择
+// 调用方需通过 Instance.Acquire/Release 维护请求数
+type LeastConnBalance struct {
+}
+
+func init() {
+	mustRegister("least_conn", func() Balancer {
+		return &LeastConnBalance{}
+	})
+}
+
+func (p *LeastConnBalance) DoBalance(instanceList []*Instance) (*Instance, error) {
+	return p.Pick(context.Background(), "", instanceList)
+}
+
+func (p *LeastConnBalance) Pick(ctx context.Context, key string, instanceList []*Instance) (*Instance, error) {
+	if len(instanceList) == 0 {
+		return nil, ErrNoInstance
+	}
+	instanceList, err := availableInstances(instanceList)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		inst  *Instance
+		least int64
+		ties  int
+	)
+	for _, v := range instanceList {
+		n := v.GetInflight()
+		switch {
+		case inst == nil || n < least:
+			inst, least, ties = v, n, 1
+		case n == least:
+			// 蓄水池抽样，在请求数相同的实例中等概率选择
+			ties++
+			if rand.Intn(ties) == 0 {
+				inst = v
+			}
+		}
+	}
+	inst.markPicked()
+
+	return inst, nil
+}
@@ -0,0 +1,77 @@
+package balance
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket 令牌桶限流
+type tokenBucket struct {
+	rate  float64 // 每秒生成的令牌数
+	burst float64 // 桶容量
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(qps float64, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   qps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// refill 按流逝时间补充令牌，调用方需持有锁
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// ready 桶中是否有令牌，不消耗令牌
+func (b *tokenBucket) ready() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill(time.Now())
+	return b.tokens >= 1
+}
+
+// take 消耗一个令牌，并发选择同一实例时允许短暂透支，由后续补充抵消
+func (b *tokenBucket) take() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill(time.Now())
+	b.tokens--
+}
+
+// SetRateLimit 设置实例限流，qps为每秒允许的请求数，burst为允许的突发请求数，qps<=0 时取消限流
+func (i *Instance) SetRateLimit(qps float64, burst int) {
+	if qps <= 0 {
+		i.limiter.Store((*tokenBucket)(nil))
+		return
+	}
+	i.limiter.Store(newTokenBucket(qps, burst))
+}
+
+func (i *Instance) rateLimiter() *tokenBucket {
+	b, _ := i.limiter.Load().(*tokenBucket)
+	return b
+}
+
+// IsRateLimited 令牌桶是否已空
+func (i *Instance) IsRateLimited() bool {
+	if b := i.rateLimiter(); b != nil {
+		return !b.ready()
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package balance
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	latencyDecay = 0.3 // EWMA延迟的衰减系数，越大越偏向最近的采样
+)
+
+// Acquire 占用一个请求槽位，调用结束后必须调用 Release
+//
+//	inst.Acquire()
+//	defer inst.Release()
+func (i *Instance) Acquire() {
+	atomic.AddInt64(&i.inflight, 1)
+}
+
+// Release 释放 Acquire 占用的请求槽位
+func (i *Instance) Release() {
+	atomic.AddInt64(&i.inflight, -1)
+}
+
+// GetInflight 获取正在处理的请求数
+func (i *Instance) GetInflight() int64 {
+	return atomic.LoadInt64(&i.inflight)
+}
+
+// ObserveLatency 记录一次调用耗时，更新EWMA延迟和耗时直方图
+func (i *Instance) ObserveLatency(d time.Duration) {
+	if d < 0 {
+		return
+	}
+	atomic.AddInt64(&i.latencySum, int64(d))
+	atomic.AddInt64(&i.latencyHist[latencyBucket(d)], 1)
+	for {
+		old := atomic.LoadInt64(&i.latency)
+		next := int64(d)
+		if old > 0 {
+			next = int64(float64(old)*(1-latencyDecay) + float64(d)*latencyDecay)
+		}
+		if atomic.CompareAndSwapInt64(&i.latency, old, next) {
+			return
+		}
+	}
+}
+
+// GetLatency 获取EWMA延迟，没有采样时为0
+func (i *Instance) GetLatency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&i.latency))
+}
+
+// load 实例负载，EWMA延迟乘以(请求数+1)，没有延迟采样时只看请求数
+func (i *Instance) load() float64 {
+	inflight := float64(i.GetInflight() + 1)
+	if latency := i.GetLatency(); latency > 0 {
+		return float64(latency) * inflight
+	}
+	return inflight
+}
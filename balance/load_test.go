@@ -0,0 +1,78 @@
+package balance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInstance_ObserveLatency(t *testing.T) {
+	inst := NewInstance("10.0.0.1", 80, 1)
+	inst.ObserveLatency(100 * time.Millisecond)
+	if inst.GetLatency() != 100*time.Millisecond {
+		t.Fatalf("first sample should be used directly, got %s", inst.GetLatency())
+	}
+	for i := 0; i < 50; i++ {
+		inst.ObserveLatency(10 * time.Millisecond)
+	}
+	if d := inst.GetLatency(); d < 10*time.Millisecond || d > 11*time.Millisecond {
+		t.Errorf("latency should converge to 10ms, got %s", d)
+	}
+}
+
+func TestLeastConnBalance(t *testing.T) {
+	list := newTestInstances(3)
+	list[0].Acquire()
+	list[0].Acquire()
+	list[2].Acquire()
+
+	p := &LeastConnBalance{}
+	for i := 0; i < 10; i++ {
+		inst, _ := p.DoBalance(list)
+		if inst != list[1] {
+			t.Fatalf("picked %s, expected %s", inst.GetAddr(), list[1].GetAddr())
+		}
+	}
+
+	list[0].Release()
+	list[0].Release()
+	list[1].Acquire()
+	inst, _ := p.DoBalance(list)
+	if inst != list[0] {
+		t.Errorf("picked %s, expected %s", inst.GetAddr(), list[0].GetAddr())
+	}
+}
+
+func TestP2CBalance_AvoidSlow(t *testing.T) {
+	list := newTestInstances(4)
+	for _, inst := range list {
+		inst.ObserveLatency(5 * time.Millisecond)
+	}
+	slow := list[2]
+	slow.ObserveLatency(time.Second)
+
+	p := &P2CBalance{}
+	for i := 0; i < 1000; i++ {
+		inst, _ := p.DoBalance(list)
+		if inst == slow {
+			t.Fatal("picked slow instance")
+		}
+	}
+	for _, inst := range list {
+		if inst != slow && inst.GetCallTimes() == 0 {
+			t.Errorf("%s never picked", inst.GetAddr())
+		}
+	}
+}
+
+func TestP2CBalance_Inflight(t *testing.T) {
+	list := newTestInstances(2)
+	for i := 0; i < 10; i++ {
+		list[0].Acquire()
+	}
+	p := &P2CBalance{}
+	for i := 0; i < 100; i++ {
+		if inst, _ := p.DoBalance(list); inst != list[1] {
+			t.Fatal("picked busy instance")
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package balance
+
+import (
+	"context"
+)
+
+const (
+	LabelZone = "zone" // 实例所在区域的元数据key
+
+	defaultMinHealthy = 0.7 // 默认健康比例阈值
+)
+
+type zoneKey struct{}
+
+// WithZone 在请求上下文中指定调用方所在区域，优先于 LocalityBalance.Zone
+func WithZone(ctx context.Context, zone string) context.Context {
+	return context.WithValue(ctx, zoneKey{}, zone)
+}
+
+// ZoneFromContext 获取请求上下文中的调用方区域
+func ZoneFromContext(ctx context.Context) string {
+	zone, _ := ctx.Value(zoneKey{}).(string)
+	return zone
+}
+
+// GetZone 获取实例所在区域
+func (i *Instance) GetZone() string {
+	return i.GetLabel(LabelZone)
+}
+
+// LocalityBalance 区域感知负载均衡，按优先级将实例分层：
+// 调用方所在区域为第一层，Failover 中的区域依次为后续各层，其余区域为最后一层。
+// 已选中层的健康实例数低于第一层规模乘以 MinHealthy 时溢出到下一层，层内由 Balancer 选择实例
+type LocalityBalance struct {
+	Zone       string   // 调用方所在区域
+	Failover   []string // 本区域之后的区域优先级
+	MinHealthy float64  // 健康实例比例阈值，<=0 时使用默认值
+	Balancer   Balancer // 层内选择算法
+}
+
+// NewLocalityBalance 创建区域感知负载均衡
+func NewLocalityBalance(zone string, failover []string, balancer Balancer) *LocalityBalance {
+	return &LocalityBalance{
+		Zone:       zone,
+		Failover:   failover,
+		MinHealthy: defaultMinHealthy,
+		Balancer:   balancer,
+	}
+}
+
+func (p *LocalityBalance) DoBalance(instanceList []*Instance) (*Instance, error) {
+	return p.Pick(context.Background(), "", instanceList)
+}
+
+func (p *LocalityBalance) Pick(ctx context.Context, key string, instanceList []*Instance) (*Instance, error) {
+	if len(instanceList) == 0 {
+		return nil, ErrNoInstance
+	}
+	return p.Balancer.Pick(ctx, key, p.candidates(ctx, instanceList))
+}
+
+// candidates 逐层累加健康且未被熔断、限流的实例，直到数量达到第一层规模乘以健康比例阈值
+func (p *LocalityBalance) candidates(ctx context.Context, instanceList []*Instance) []*Instance {
+	zone := ZoneFromContext(ctx)
+	if zone == "" {
+		zone = p.Zone
+	}
+	minHealthy := p.MinHealthy
+	if minHealthy <= 0 {
+		minHealthy = defaultMinHealthy
+	}
+
+	var (
+		healthy []*Instance
+		want    float64 // 需要的健康实例数，按第一个非空层的规模计算
+	)
+	for _, tier := range p.tiers(zone, instanceList) {
+		if len(tier) == 0 {
+			continue
+		}
+		if want == 0 {
+			want = minHealthy * float64(len(tier))
+		}
+		for _, inst := range tier {
+			if inst.IsHealthy() && inst.IsAvailable() {
+				healthy = append(healthy, inst)
+			}
+		}
+		if len(healthy) > 0 && float64(len(healthy)) >= want {
+			return healthy
+		}
+	}
+	if len(healthy) > 0 {
+		return healthy
+	}
+	return instanceList
+}
+
+// tiers 按区域优先级对实例分层
+func (p *LocalityBalance) tiers(zone string, instanceList []*Instance) [][]*Instance {
+	priority := make(map[string]int, len(p.Failover)+1)
+	for i := len(p.Failover) - 1; i >= 0; i-- {
+		priority[p.Failover[i]] = i + 1
+	}
+	priority[zone] = 0
+
+	rest := len(p.Failover) + 1
+	tiers := make([][]*Instance, rest+1)
+	for _, inst := range instanceList {
+		level, ok := priority[inst.GetZone()]
+		if !ok {
+			level = rest
+		}
+		tiers[level] = append(tiers[level], inst)
+	}
+	return tiers
+}
@@ -0,0 +1,82 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func newZoneInstances(zone string, n int) []*Instance {
+	list := make([]*Instance, 0, n)
+	for i := 0; i < n; i++ {
+		inst := NewInstance(fmt.Sprintf("%s-%d", zone, i), 80, 1)
+		list = append(list, inst.WithLabels(map[string]string{LabelZone: zone}))
+	}
+	return list
+}
+
+func TestLocalityBalance(t *testing.T) {
+	a := newZoneInstances("a", 4)
+	b := newZoneInstances("b", 2)
+	c := newZoneInstances("c", 2)
+	list := append(append(append([]*Instance{}, c...), b...), a...)
+
+	p := NewLocalityBalance("a", []string{"b"}, &RoundRobinBalance{})
+	pickZones := func(ctx context.Context) map[string]int {
+		zones := make(map[string]int)
+		for i := 0; i < 100; i++ {
+			inst, err := p.Pick(ctx, "", list)
+			if err != nil {
+				t.Fatal(err)
+			}
+			zones[inst.GetZone()]++
+		}
+		return zones
+	}
+
+	if zones := pickZones(context.Background()); zones["a"] != 100 {
+		t.Fatalf("expected only local zone, got %v", zones)
+	}
+
+	// 本区域健康比例 3/4 仍高于阈值
+	a[0].SetProbeResult(false)
+	if zones := pickZones(context.Background()); zones["a"] != 100 {
+		t.Fatalf("expected only local zone, got %v", zones)
+	}
+
+	// 本区域健康比例 2/4 低于阈值，溢出到 b
+	a[1].SetProbeResult(false)
+	if zones := pickZones(context.Background()); zones["a"] == 0 || zones["b"] == 0 || zones["c"] != 0 {
+		t.Fatalf("expected spill over to zone b, got %v", zones)
+	}
+
+	// a、b 都不可用时使用剩余区域
+	for _, inst := range append(a, b...) {
+		inst.SetProbeResult(false)
+	}
+	if zones := pickZones(context.Background()); zones["c"] != 100 {
+		t.Fatalf("expected zone c, got %v", zones)
+	}
+
+	// 请求上下文中的区域优先
+	for _, inst := range list {
+		inst.SetProbeResult(true)
+	}
+	if zones := pickZones(WithZone(context.Background(), "c")); zones["c"] != 100 {
+		t.Fatalf("expected zone from context, got %v", zones)
+	}
+}
+
+func TestLocalityBalance_AllDown(t *testing.T) {
+	list := newZoneInstances("a", 2)
+	for _, inst := range list {
+		inst.SetProbeResult(false)
+	}
+	p := NewLocalityBalance("a", nil, &RandomBalance{})
+	if _, err := p.DoBalance(list); err != nil {
+		t.Error(err)
+	}
+	if _, err := p.DoBalance(nil); err != ErrNoInstance {
+		t.Errorf("expected ErrNoInstance, got %v", err)
+	}
+}
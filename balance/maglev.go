@@ -0,0 +1,169 @@
+package balance
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultMaglevTableSize = 65537 // 默认查找表大小，需为质数且远大于实例数
+)
+
+// Maglev一致性hash算法（Google Maglev），实例变更时构建查找表，按key查找为O(1)
+// 相比hash环分布更均匀，实例增减时迁移的key略多于1/N
+type MaglevBalance struct {
+	TableSize uint64 // 查找表大小，非质数时取下一个质数，0 使用默认值
+
+	lock  sync.Mutex
+	table *maglevTable
+}
+
+func init() {
+	mustRegister("maglev", func() Balancer {
+		return &MaglevBalance{}
+	})
+}
+
+// NewMaglevBalance 创建Maglev负载均衡，tableSize为查找表大小
+func NewMaglevBalance(tableSize uint64) *MaglevBalance {
+	return &MaglevBalance{TableSize: tableSize}
+}
+
+func (p *MaglevBalance) DoBalance(instanceList []*Instance) (*Instance, error) {
+	return p.Pick(context.Background(), "", instanceList)
+}
+
+// Pick 根据key在查找表中选择实例，key为空时随机生成，等同于随机选择
+func (p *MaglevBalance) Pick(ctx context.Context, key string, instanceList []*Instance) (*Instance, error) {
+	if len(instanceList) == 0 {
+		return nil, ErrNoInstance
+	}
+	if key == "" {
+		key = strconv.Itoa(rand.Int())
+	}
+
+	p.lock.Lock()
+	if p.table == nil || !p.table.current(instanceList) {
+		p.table = newMaglevTable(p.TableSize, instanceList)
+	}
+	inst, err := p.table.get(key)
+	p.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	inst.markPicked()
+
+	return inst, nil
+}
+
+// OnUpdate 实例池变更时重建查找表
+func (p *MaglevBalance) OnUpdate(instanceList []*Instance) {
+	table := newMaglevTable(p.TableSize, instanceList)
+	p.lock.Lock()
+	p.table = table
+	p.lock.Unlock()
+}
+
+// maglevTable Maglev查找表，实例列表不变时复用
+type maglevTable struct {
+	memberSet
+	backends []string // 按地址排序的实例
+	entry    []int    // 查找表，槽位 -> backends 下标
+}
+
+// newMaglevTable 每个实例按 offset、skip 生成槽位排列，轮流占据各自排列中的下一个空槽位，直到填满
+func newMaglevTable(size uint64, instanceList []*Instance) *maglevTable {
+	if size == 0 {
+		size = defaultMaglevTableSize
+	}
+	size = nextPrime(size)
+
+	t := &maglevTable{memberSet: newMemberSet(instanceList)}
+	t.backends = t.addrs()
+	n := uint64(len(t.backends))
+	if n == 0 {
+		return t
+	}
+
+	offsets := make([]uint64, n)
+	skips := make([]uint64, n)
+	for i, addr := range t.backends {
+		offsets[i] = hashString(addr, "offset") % size
+		skips[i] = hashString(addr, "skip")%(size-1) + 1
+	}
+
+	t.entry = make([]int, size)
+	for i := range t.entry {
+		t.entry[i] = -1
+	}
+	next := make([]uint64, n)
+	var filled uint64
+	for {
+		for i := uint64(0); i < n; i++ {
+			c := (offsets[i] + next[i]*skips[i]) % size
+			for t.entry[c] >= 0 {
+				next[i]++
+				c = (offsets[i] + next[i]*skips[i]) % size
+			}
+			t.entry[c] = int(i)
+			next[i]++
+			filled++
+			if filled == size {
+				return t
+			}
+		}
+	}
+}
+
+// get 按key查找实例，命中的实例不健康或不可用时顺序查找后续槽位
+func (t *maglevTable) get(key string) (*Instance, error) {
+	size := uint64(len(t.entry))
+	idx := hashString(key, "") % size
+	return walkPick(len(t.entry), len(t.backends), func(i int) *Instance {
+		return t.members[t.backends[t.entry[(idx+uint64(i))%size]]]
+	})
+}
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// hashString FNV-1a 64位hash，seed作为前缀，避免分配内存
+func hashString(s, seed string) uint64 {
+	var h uint64 = fnvOffset64
+	for i := 0; i < len(seed); i++ {
+		h ^= uint64(seed[i])
+		h *= fnvPrime64
+	}
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime64
+	}
+	return h
+}
+
+// nextPrime 不小于n的最小质数
+func nextPrime(n uint64) uint64 {
+	if n <= 2 {
+		return 2
+	}
+	if n%2 == 0 {
+		n++
+	}
+	for ; ; n += 2 {
+		prime := true
+		for i := uint64(3); i*i <= n; i += 2 {
+			if n%i == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			return n
+		}
+	}
+}
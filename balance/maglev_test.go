@@ -0,0 +1,124 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestNextPrime(t *testing.T) {
+	for n, want := range map[uint64]uint64{0: 2, 2: 2, 3: 3, 4: 5, 100: 101, 65536: 65537, 65537: 65537} {
+		if got := nextPrime(n); got != want {
+			t.Errorf("nextPrime(%d) = %d, expected %d", n, got, want)
+		}
+	}
+}
+
+func TestMaglevBalance_Even(t *testing.T) {
+	const n = 10
+	p := NewMaglevBalance(0)
+	list := newTestInstances(n)
+	_, _ = p.DoBalance(list)
+
+	// 查找表中每个实例占据的槽位数应接近 M/N
+	counts := make(map[int]int)
+	for _, b := range p.table.entry {
+		counts[b]++
+	}
+	expected := float64(len(p.table.entry)) / n
+	for b, c := range counts {
+		if diff := float64(c)/expected - 1; diff > 0.02 || diff < -0.02 {
+			t.Errorf("%s owns %d entries, expected %.0f", p.table.backends[b], c, expected)
+		}
+	}
+
+	// 按key选择的分布
+	for i := 0; i < 50000; i++ {
+		_, _ = p.Pick(context.Background(), fmt.Sprintf("key-%d", i), list)
+	}
+	for _, inst := range list {
+		picks := float64(inst.GetCallTimes()) / 5000
+		if picks < 0.9 || picks > 1.1 {
+			t.Errorf("%s picked %d times, expected about 5000", inst.GetAddr(), inst.GetCallTimes())
+		}
+	}
+}
+
+func TestMaglevBalance_Remove(t *testing.T) {
+	const (
+		n    = 10
+		keys = 50000
+	)
+	p := NewMaglevBalance(0)
+	list := newTestInstances(n)
+
+	before := make(map[string]string, keys)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("conn-%d", i)
+		inst, _ := p.Pick(context.Background(), key, list)
+		before[key] = inst.GetAddr()
+	}
+
+	removed := list[6].GetAddr()
+	rest := append(append([]*Instance{}, list[:6]...), list[7:]...)
+	moved, lost := 0, 0
+	for key, addr := range before {
+		inst, _ := p.Pick(context.Background(), key, rest)
+		if inst.GetAddr() == removed {
+			t.Fatalf("key %s still mapped to removed instance", key)
+		}
+		if addr == removed {
+			lost++
+		} else if inst.GetAddr() != addr {
+			moved++
+		}
+	}
+	// 除被移除实例上的key外，只有少量key在存活实例间迁移
+	ratio := float64(moved) / keys
+	t.Logf("keys on removed instance %.3f, moved between surviving instances %.3f", float64(lost)/keys, ratio)
+	if ratio > 0.05 {
+		t.Errorf("moved %.3f of keys between surviving instances", ratio)
+	}
+}
+
+func TestMaglevBalance_Pool(t *testing.T) {
+	b := NewMaglevBalance(1000)
+	p := NewPool(b, newTestInstances(3)...)
+	if b.table == nil || len(b.table.entry) != 1009 {
+		t.Fatal("table not built with the next prime size")
+	}
+	table := b.table
+	// Pick 传入的是 OnUpdate 的快照，不需要逐个比较实例
+	table.size = -1
+	first, _ := p.Pick(context.Background(), "user-1")
+	if b.table != table {
+		t.Fatal("table rebuilt on pick")
+	}
+	again, _ := p.Pick(context.Background(), "user-1")
+	if again != first {
+		t.Error("same key picked different instances")
+	}
+
+	first.SetProbeResult(false)
+	if inst, _ := p.Pick(context.Background(), "user-1"); inst == first {
+		t.Error("picked unhealthy instance")
+	}
+}
+
+func TestMaglevBalance_StalePick(t *testing.T) {
+	b := NewMaglevBalance(1000)
+	old := newTestInstances(3)
+	p := NewPool(b, old...)
+	stale := p.Snapshot()
+	p.Add(NewInstance("10.0.0.9", 8080, 1))
+
+	// 持有旧快照的 Pick 重建查找表后，新快照重建一次即恢复直接复用
+	_, _ = b.Pick(context.Background(), "a", stale)
+	_, _ = p.Pick(context.Background(), "a")
+	table := b.table
+	table.size = -1
+	_, _ = p.Pick(context.Background(), "b")
+	if b.table != table {
+		t.Error("table rebuilt for the snapshot it was built from")
+	}
+}
@@ -1,37 +1,162 @@
 package balance
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
 )
 
 var (
-	balanceMgr = BalancerManager{
-		allBalance: make(map[string]Balancer),
-	}
+	balanceMgr = NewBalancerManager()
+
+	ErrNoInstance          = errors.New("no instance found")           // 没有配置实例
+	ErrNoAvailableInstance = errors.New("no available instance found") // 实例均被熔断或限流
+	ErrDuplicateBalancer   = errors.New("balancer already registered") // 重复注册
 )
 
 // 负载均衡
 type Balancer interface {
+	// DoBalance 不携带请求信息选择实例，等同于 Pick(context.Background(), "", instanceList)
 	DoBalance([]*Instance) (*Instance, error)
+	// Pick 根据请求上下文和key选择实例，key可以是用户ID、会话ID等，不关心key的算法忽略它
+	Pick(ctx context.Context, key string, instanceList []*Instance) (*Instance, error)
 }
 
-// 负载均衡管理器
+// Factory 负载均衡构造函数，每次调用返回一个新的负载均衡，使轮询游标、hash环等状态互不影响
+type Factory func() Balancer
+
+// 负载均衡管理器，并发安全
 type BalancerManager struct {
-	allBalance map[string]Balancer
+	lock      sync.RWMutex
+	factories map[string]Factory
+	shared    map[string]Balancer // DoBalance/Pick 按名称使用的共享实例，首次使用时创建
+}
+
+// NewBalancerManager 创建负载均衡管理器
+func NewBalancerManager() *BalancerManager {
+	return &BalancerManager{
+		factories: make(map[string]Factory),
+		shared:    make(map[string]Balancer),
+	}
 }
 
-func (p *BalancerManager) register(balanceType string, b Balancer) {
-	p.allBalance[balanceType] = b
+// Register 注册负载均衡构造函数，名称已存在时返回 ErrDuplicateBalancer
+func (p *BalancerManager) Register(balanceType string, f Factory) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.factories[balanceType]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateBalancer, balanceType)
+	}
+	p.factories[balanceType] = f
+	return nil
 }
 
-func RegisterBalancer(balanceType string, b Balancer) {
-	balanceMgr.register(balanceType, b)
+// Unregister 注销负载均衡，返回是否存在
+func (p *BalancerManager) Unregister(balanceType string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	_, ok := p.factories[balanceType]
+	delete(p.factories, balanceType)
+	delete(p.shared, balanceType)
+	return ok
 }
 
-func DoBalance(balanceType string, instanceList []*Instance) (*Instance, error) {
-	balancer, ok := balanceMgr.allBalance[balanceType]
+// List 已注册的负载均衡名称，按名称排序
+func (p *BalancerManager) List() []string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	names := make([]string, 0, len(p.factories))
+	for name := range p.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New 创建一个新的负载均衡
+func (p *BalancerManager) New(balanceType string) (Balancer, error) {
+	p.lock.RLock()
+	f, ok := p.factories[balanceType]
+	p.lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("not found %s balancer", balanceType)
+	}
+	return f(), nil
+}
+
+// Get 获取按名称共享的负载均衡
+func (p *BalancerManager) Get(balanceType string) (Balancer, error) {
+	p.lock.RLock()
+	b, ok := p.shared[balanceType]
+	p.lock.RUnlock()
+	if ok {
+		return b, nil
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if b, ok = p.shared[balanceType]; ok {
+		return b, nil
+	}
+	f, ok := p.factories[balanceType]
 	if !ok {
 		return nil, fmt.Errorf("not found %s balancer", balanceType)
 	}
-	return balancer.DoBalance(instanceList)
+	b = f()
+	p.shared[balanceType] = b
+	return b, nil
+}
+
+// RegisterFactory 注册负载均衡构造函数
+func RegisterFactory(balanceType string, f Factory) error {
+	return balanceMgr.Register(balanceType, f)
+}
+
+// RegisterBalancer 注册负载均衡，b 会被所有使用者共享，有状态的算法应使用 RegisterFactory
+func RegisterBalancer(balanceType string, b Balancer) error {
+	return balanceMgr.Register(balanceType, func() Balancer {
+		return b
+	})
+}
+
+// UnregisterBalancer 注销负载均衡
+func UnregisterBalancer(balanceType string) bool {
+	return balanceMgr.Unregister(balanceType)
+}
+
+// ListBalancers 已注册的负载均衡名称
+func ListBalancers() []string {
+	return balanceMgr.List()
+}
+
+// NewBalancer 按名称创建一个新的负载均衡，供实例池独占使用
+func NewBalancer(balanceType string) (Balancer, error) {
+	return balanceMgr.New(balanceType)
+}
+
+// mustRegister 注册内置负载均衡，重复注册时panic
+func mustRegister(balanceType string, f Factory) {
+	if err := RegisterFactory(balanceType, f); err != nil {
+		panic(err)
+	}
+}
+
+func DoBalance(balanceType string, instanceList []*Instance) (*Instance, error) {
+	return Pick(context.Background(), balanceType, "", instanceList)
+}
+
+// DoBalanceKey 按key选择实例，不支持key的负载均衡算法忽略key
+func DoBalanceKey(balanceType, key string, instanceList []*Instance) (*Instance, error) {
+	return Pick(context.Background(), balanceType, key, instanceList)
+}
+
+// Pick 使用指定的负载均衡算法，根据请求上下文和key选择实例，同名调用共享同一个负载均衡
+func Pick(ctx context.Context, balanceType, key string, instanceList []*Instance) (*Instance, error) {
+	balancer, err := balanceMgr.Get(balanceType)
+	if err != nil {
+		return nil, err
+	}
+	return balancer.Pick(ctx, key, instanceList)
 }
@@ -0,0 +1,116 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// newAllBalancers 为每个已注册的负载均衡创建新实例
+func newAllBalancers(t *testing.T) map[string]Balancer {
+	all := make(map[string]Balancer)
+	for _, name := range ListBalancers() {
+		b, err := NewBalancer(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all[name] = b
+	}
+	return all
+}
+
+func TestPick(t *testing.T) {
+	list := newTestInstances(3)
+	for _, name := range ListBalancers() {
+		inst, err := Pick(context.Background(), name, "user-1", list)
+		if err != nil || inst == nil {
+			t.Errorf("%s: Pick failed: %v", name, err)
+		}
+		if _, err = DoBalance(name, list); err != nil {
+			t.Errorf("%s: DoBalance failed: %v", name, err)
+		}
+		if _, err = Pick(context.Background(), name, "user-1", nil); err != ErrNoInstance {
+			t.Errorf("%s: expected ErrNoInstance, got %v", name, err)
+		}
+	}
+}
+
+func TestBalancerManager(t *testing.T) {
+	m := NewBalancerManager()
+	if err := m.Register("rr", func() Balancer { return &RoundRobinBalance{} }); err != nil {
+		t.Fatal(err)
+	}
+	err := m.Register("rr", func() Balancer { return &RandomBalance{} })
+	if !errors.Is(err, ErrDuplicateBalancer) {
+		t.Fatalf("expected ErrDuplicateBalancer, got %v", err)
+	}
+	if names := m.List(); len(names) != 1 || names[0] != "rr" {
+		t.Fatalf("unexpected list %v", names)
+	}
+
+	// 每次创建独立的负载均衡，共享实例只创建一次
+	a, _ := m.New("rr")
+	b, _ := m.New("rr")
+	if a == b {
+		t.Error("factory returned the same balancer")
+	}
+	s1, _ := m.Get("rr")
+	s2, _ := m.Get("rr")
+	if s1 != s2 {
+		t.Error("shared balancer created twice")
+	}
+
+	if !m.Unregister("rr") || m.Unregister("rr") {
+		t.Error("unexpected unregister result")
+	}
+	if _, err = m.Get("rr"); err == nil {
+		t.Error("expected error after unregister")
+	}
+}
+
+func TestNewPoolByType(t *testing.T) {
+	list := newTestInstances(2)
+	a, err := NewPoolByType("roundrobin", list...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewPoolByType("roundrobin", list...)
+	if a.Balancer() == b.Balancer() {
+		t.Fatal("pools share a balancer")
+	}
+	// 两个实例池的轮询游标互不影响
+	x, _ := a.DoBalance()
+	y, _ := b.DoBalance()
+	if x != y {
+		t.Error("pool cursors are not independent")
+	}
+	if _, err = NewPoolByType("none"); err == nil {
+		t.Error("expected error for unknown balancer")
+	}
+}
+
+func TestRegisterBalancer_Concurrent(t *testing.T) {
+	list := newTestInstances(2)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = RegisterBalancer("test_concurrent", &RandomBalance{})
+			UnregisterBalancer("test_concurrent")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_, _ = DoBalance("test_concurrent", list)
+			_, _ = DoBalance("random", list)
+		}
+	}()
+	wg.Wait()
+
+	if err := RegisterBalancer("random", &RandomBalance{}); !errors.Is(err, ErrDuplicateBalancer) {
+		t.Errorf("expected ErrDuplicateBalancer, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package balance
+
+import (
+	"context"
+	"math/rand"
+)
+
+// 两次随机选择算法（power of two choices），随机选出两个实例，取负载较低的一个
+// 负载为EWMA延迟乘以(请求数+1)，调用方需通过 Instance.Acquire/Release/ObserveLatency 上报
+type P2CBalance struct {
+}
+
+func init() {
+	mustRegister("p2c", func() Balancer {
+		return &P2CBalance{}
+	})
+}
+
+func (p *P2CBalance) DoBalance(instanceList []*Instance) (*Instance, error) {
+	return p.Pick(context.Background(), "", instanceList)
+}
+
+func (p *P2CBalance) Pick(ctx context.Context, key string, instanceList []*Instance) (*Instance, error) {
+	if len(instanceList) == 0 {
+		return nil, ErrNoInstance
+	}
+	instanceList, err := availableInstances(instanceList)
+	if err != nil {
+		return nil, err
+	}
+	lens := len(instanceList)
+
+	inst := instanceList[0]
+	if lens > 1 {
+		a := rand.Intn(lens)
+		b := rand.Intn(lens - 1)
+		if b >= a {
+			b++
+		}
+		inst = instanceList[a]
+		if instanceList[b].load() < inst.load() {
+			inst = instanceList[b]
+		}
+	}
+	inst.markPicked()
+
+	return inst, nil
+}
@@ -0,0 +1,182 @@
+package balance
+
+import (
+	"context"
+	"hash/crc32"
+	"sync"
+	"sync/atomic"
+)
+
+// Observer 感知实例变更的负载均衡算法，Pool 变更后回调，用于重建hash环等状态
+type Observer interface {
+	OnUpdate(instanceList []*Instance)
+}
+
+// Pool 实例池，持有实例集合和负载均衡算法
+// 实例列表采用写时复制，Pick/Snapshot 不加锁，不会被写操作阻塞
+type Pool struct {
+	balancer Balancer
+
+	instances atomic.Value // []*Instance，只读快照
+	lock      sync.Mutex   // 串行化写操作
+	callbacks []func(instanceList []*Instance)
+}
+
+// NewPool 创建实例池，balancer 只应被这一个实例池使用
+func NewPool(balancer Balancer, instanceList ...*Instance) *Pool {
+	p := &Pool{balancer: balancer}
+	p.store(dedupInstances(nil, instanceList))
+	return p
+}
+
+// NewPoolByType 按名称创建独占的负载均衡，并创建实例池
+func NewPoolByType(balanceType string, instanceList ...*Instance) (*Pool, error) {
+	balancer, err := NewBalancer(balanceType)
+	if err != nil {
+		return nil, err
+	}
+	return NewPool(balancer, instanceList...), nil
+}
+
+// Balancer 获取实例池使用的负载均衡算法
+func (p *Pool) Balancer() Balancer {
+	return p.balancer
+}
+
+// Pick 根据请求上下文和key选择实例
+func (p *Pool) Pick(ctx context.Context, key string) (*Instance, error) {
+	return p.balancer.Pick(ctx, key, p.load())
+}
+
+// PickExcept 在 exclude 之外的实例中确定性地选择，用于失败后换实例重试，不经过负载均衡算法，
+// 不改变hash查找表、轮询游标等状态，只记录最终选中的实例。
+// 规则与 availableInstances 一致，key 不为空时按key的hash选择，否则选择进行中请求最少的实例，
+// 全部实例都被排除时返回 ErrNoInstance
+func (p *Pool) PickExcept(key string, exclude map[*Instance]struct{}) (*Instance, error) {
+	all := p.load()
+	rest := make([]*Instance, 0, len(all))
+	for _, inst := range all {
+		if _, ok := exclude[inst]; !ok {
+			rest = append(rest, inst)
+		}
+	}
+	if len(rest) == 0 {
+		return nil, ErrNoInstance
+	}
+	candidates, err := availableInstances(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	inst := candidates[0]
+	if key != "" {
+		inst = candidates[crc32.ChecksumIEEE([]byte(key))%uint32(len(candidates))]
+	} else {
+		for _, c := range candidates[1:] {
+			if c.GetInflight() < inst.GetInflight() {
+				inst = c
+			}
+		}
+	}
+	inst.markPicked()
+	return inst, nil
+}
+
+// DoBalance 不携带请求信息选择实例
+func (p *Pool) DoBalance() (*Instance, error) {
+	return p.Pick(context.Background(), "")
+}
+
+// Snapshot 获取当前实例列表的副本
+func (p *Pool) Snapshot() []*Instance {
+	instanceList := p.load()
+	snapshot := make([]*Instance, len(instanceList))
+	copy(snapshot, instanceList)
+	return snapshot
+}
+
+// Len 实例数量
+func (p *Pool) Len() int {
+	return len(p.load())
+}
+
+// Add 添加实例，地址相同的实例会被替换
+func (p *Pool) Add(instanceList ...*Instance) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.commit(dedupInstances(p.load(), instanceList))
+}
+
+// Remove 按地址移除实例
+func (p *Pool) Remove(instanceList ...*Instance) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	removed := make(map[string]struct{}, len(instanceList))
+	for _, inst := range instanceList {
+		removed[inst.GetAddr()] = struct{}{}
+	}
+	old := p.load()
+	next := make([]*Instance, 0, len(old))
+	for _, inst := range old {
+		if _, ok := removed[inst.GetAddr()]; !ok {
+			next = append(next, inst)
+		}
+	}
+	if len(next) == len(old) {
+		return
+	}
+	p.commit(next)
+}
+
+// Update 使用新的实例列表替换全部实例
+func (p *Pool) Update(instanceList ...*Instance) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.commit(dedupInstances(nil, instanceList))
+}
+
+// OnChange 注册实例变更回调，回调在写锁内按变更顺序执行，回调中不能再修改实例池
+func (p *Pool) OnChange(fn func(instanceList []*Instance)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.callbacks = append(p.callbacks, fn)
+}
+
+func (p *Pool) load() []*Instance {
+	instanceList, _ := p.instances.Load().([]*Instance)
+	return instanceList
+}
+
+func (p *Pool) store(instanceList []*Instance) {
+	p.instances.Store(instanceList)
+	if o, ok := p.balancer.(Observer); ok {
+		o.OnUpdate(instanceList)
+	}
+}
+
+// commit 发布新的实例列表并通知回调，调用方需持有写锁
+func (p *Pool) commit(instanceList []*Instance) {
+	p.store(instanceList)
+	for _, fn := range p.callbacks {
+		fn(instanceList)
+	}
+}
+
+// dedupInstances 将 added 合并到 base 的副本中，地址相同时后者替换前者
+func dedupInstances(base, added []*Instance) []*Instance {
+	next := make([]*Instance, 0, len(base)+len(added))
+	index := make(map[string]int, len(base)+len(added))
+	for _, list := range [][]*Instance{base, added} {
+		for _, inst := range list {
+			addr := inst.GetAddr()
+			if i, ok := index[addr]; ok {
+				next[i] = inst
+				continue
+			}
+			index[addr] = len(next)
+			next = append(next, inst)
+		}
+	}
+	return next
+}
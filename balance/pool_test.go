@@ -0,0 +1,141 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestPool_Membership(t *testing.T) {
+	list := newTestInstances(3)
+	p := NewPool(&RoundRobinBalance{}, list...)
+
+	var changes [][]*Instance
+	p.OnChange(func(instanceList []*Instance) {
+		changes = append(changes, instanceList)
+	})
+
+	p.Add(NewInstance("10.0.0.4", 8080, 1))
+	if p.Len() != 4 {
+		t.Fatalf("len %d, expected 4", p.Len())
+	}
+
+	// 地址相同的实例被替换
+	replaced := NewInstance("10.0.0.1", 8080, 5)
+	p.Add(replaced)
+	if p.Len() != 4 || p.Snapshot()[0] != replaced {
+		t.Fatal("instance with the same address not replaced")
+	}
+
+	p.Remove(list[1])
+	p.Remove(NewInstance("10.0.0.9", 8080, 1))
+	if p.Len() != 3 {
+		t.Fatalf("len %d, expected 3", p.Len())
+	}
+
+	p.Update(list[2])
+	if p.Len() != 1 || p.Snapshot()[0] != list[2] {
+		t.Fatal("update did not replace all instances")
+	}
+	if len(changes) != 4 {
+		t.Errorf("%d change callbacks, expected 4", len(changes))
+	}
+}
+
+func TestPool_PickExcept(t *testing.T) {
+	list := newTestInstances(3)
+	p := NewPool(NewHashBalance(0), list...)
+	exclude := map[*Instance]struct{}{list[0]: {}}
+
+	first, err := p.PickExcept("user-1", exclude)
+	if err != nil || first == list[0] {
+		t.Fatalf("unexpected pick %v %v", first, err)
+	}
+	for i := 0; i < 10; i++ {
+		if inst, _ := p.PickExcept("user-1", exclude); inst != first {
+			t.Fatal("pick not stable for the same key")
+		}
+	}
+	if first.GetCallTimes() != 11 || list[0].GetCallTimes() != 0 {
+		t.Errorf("unexpected picks %s %s", first.GetResult(), list[0].GetResult())
+	}
+
+	// 没有key时选择进行中请求最少的实例，排除全部实例时返回 ErrNoInstance
+	list[1].Acquire()
+	defer list[1].Release()
+	if inst, _ := p.PickExcept("", exclude); inst != list[2] {
+		t.Errorf("picked %s, expected least inflight", inst.GetAddr())
+	}
+	exclude[list[1]], exclude[list[2]] = struct{}{}, struct{}{}
+	if _, err = p.PickExcept("", exclude); err != ErrNoInstance {
+		t.Errorf("expected ErrNoInstance, got %v", err)
+	}
+}
+
+func TestPool_Snapshot(t *testing.T) {
+	list := newTestInstances(3)
+	p := NewPool(&Shuffle2Balance{}, list...)
+	snapshot := p.Snapshot()
+	snapshot[0] = nil
+	if p.Snapshot()[0] == nil {
+		t.Fatal("snapshot shares memory with the pool")
+	}
+	list[0] = nil
+	if p.Snapshot()[0] == nil {
+		t.Fatal("pool shares memory with the caller's slice")
+	}
+}
+
+func TestPool_HashRebuild(t *testing.T) {
+	b := NewHashBalance(0)
+	p := NewPool(b, newTestInstances(3)...)
+	if b.ring == nil {
+		t.Fatal("ring not built on pool creation")
+	}
+	inst, _ := p.Pick(context.Background(), "user-1")
+	ring := b.ring
+
+	p.Add(NewInstance("10.0.0.9", 8080, 1))
+	if b.ring == ring {
+		t.Fatal("ring not rebuilt on pool change")
+	}
+	ring = b.ring
+	_, _ = p.Pick(context.Background(), "user-1")
+	if b.ring != ring {
+		t.Fatal("ring rebuilt on pick")
+	}
+	p.Remove(NewInstance("10.0.0.9", 8080, 1))
+	if again, _ := p.Pick(context.Background(), "user-1"); again != inst {
+		t.Error("key moved after instance set restored")
+	}
+}
+
+func TestPool_Concurrent(t *testing.T) {
+	p := NewPool(&RoundRobinBalance{}, newTestInstances(3)...)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if _, err := p.DoBalance(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				inst := NewInstance(fmt.Sprintf("10.1.%d.%d", w, i), 80, 1)
+				p.Add(inst)
+				p.Remove(inst)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if p.Len() != 3 {
+		t.Errorf("len %d, expected 3", p.Len())
+	}
+}
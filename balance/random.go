@@ -1,7 +1,7 @@
 package balance
 
 import (
-	"errors"
+	"context"
 	"math/rand"
 )
 
@@ -10,18 +10,28 @@ type RandomBalance struct {
 }
 
 func init() {
-	RegisterBalancer("random", &RandomBalance{})
+	mustRegister("random", func() Balancer {
+		return &RandomBalance{}
+	})
 }
 
 func (p *RandomBalance) DoBalance(instanceList []*Instance) (*Instance, error) {
-	lens := len(instanceList)
-	if lens == 0 {
-		return nil, errors.New("no instance found")
+	return p.Pick(context.Background(), "", instanceList)
+}
+
+func (p *RandomBalance) Pick(ctx context.Context, key string, instanceList []*Instance) (*Instance, error) {
+	if len(instanceList) == 0 {
+		return nil, ErrNoInstance
 	}
+	instanceList, err := availableInstances(instanceList)
+	if err != nil {
+		return nil, err
+	}
+	lens := len(instanceList)
 
 	index := rand.Intn(lens)
 	inst := instanceList[index]
-	inst.CallNums++
+	inst.markPicked()
 
 	return inst, nil
 }
@@ -0,0 +1,144 @@
+package balance
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Resolver 服务发现数据源，返回当前全部实例
+type Resolver interface {
+	Resolve(ctx context.Context) ([]*Instance, error)
+}
+
+// Notifier 可主动通知变更的数据源，Watcher 收到通知后立即刷新，不必等待下一个周期
+type Notifier interface {
+	Changed() <-chan struct{}
+}
+
+// StaticResolver 内存数据源，用于测试或手工维护实例
+type StaticResolver struct {
+	lock      sync.Mutex
+	instances []*Instance
+	changed   chan struct{}
+}
+
+// NewStaticResolver 创建内存数据源
+func NewStaticResolver(instanceList ...*Instance) *StaticResolver {
+	return &StaticResolver{
+		instances: instanceList,
+		changed:   make(chan struct{}, 1),
+	}
+}
+
+func (r *StaticResolver) Resolve(ctx context.Context) ([]*Instance, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	instanceList := make([]*Instance, len(r.instances))
+	copy(instanceList, r.instances)
+	return instanceList, nil
+}
+
+// Set 替换全部实例并通知 Watcher
+func (r *StaticResolver) Set(instanceList ...*Instance) {
+	r.lock.Lock()
+	r.instances = instanceList
+	r.lock.Unlock()
+
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (r *StaticResolver) Changed() <-chan struct{} {
+	return r.changed
+}
+
+const (
+	defaultRefreshInterval = 30 * time.Second // 默认刷新间隔
+)
+
+// Watcher 定时从 Resolver 获取实例并同步到实例池
+// 地址、元数据都未变化的实例沿用池中原有对象，保留调用次数、健康状态等统计
+type Watcher struct {
+	Resolver Resolver
+	Pool     *Pool
+	Interval time.Duration   // 刷新间隔，<=0 时使用默认值
+	OnError  func(err error) // 获取失败时回调，为空时忽略，实例池保持不变
+}
+
+// NewWatcher 创建服务发现同步，interval<=0 时使用默认刷新间隔
+func NewWatcher(resolver Resolver, pool *Pool, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+	return &Watcher{
+		Resolver: resolver,
+		Pool:     pool,
+		Interval: interval,
+	}
+}
+
+// Run 立即同步一次，之后定时同步，直到ctx结束
+func (w *Watcher) Run(ctx context.Context) {
+	var changed <-chan struct{}
+	if n, ok := w.Resolver.(Notifier); ok {
+		changed = n.Changed()
+	}
+	interval := w.Interval
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Refresh(ctx); err != nil && w.OnError != nil {
+			w.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-changed:
+		}
+	}
+}
+
+// Refresh 同步一次，实例集合没有变化时不更新实例池
+func (w *Watcher) Refresh(ctx context.Context) error {
+	resolved, err := w.Resolver.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if merged, changed := mergeInstances(w.Pool.Snapshot(), resolved); changed {
+		w.Pool.Update(merged...)
+	}
+	return nil
+}
+
+// mergeInstances 用 resolved 替换 current，地址和元数据相同的实例沿用原对象并更新权重
+func mergeInstances(current, resolved []*Instance) ([]*Instance, bool) {
+	exist := make(map[string]*Instance, len(current))
+	for _, inst := range current {
+		exist[inst.GetAddr()] = inst
+	}
+
+	changed := len(current) != len(resolved)
+	merged := make([]*Instance, 0, len(resolved))
+	for _, inst := range resolved {
+		old, ok := exist[inst.GetAddr()]
+		if !ok || !reflect.DeepEqual(old.Labels, inst.Labels) {
+			changed = true
+			merged = append(merged, inst)
+			continue
+		}
+		if w := inst.GetWeight(); old.GetWeight() != w {
+			old.SetWeight(w)
+		}
+		merged = append(merged, old)
+	}
+	return merged, changed
+}
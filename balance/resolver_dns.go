@@ -0,0 +1,71 @@
+package balance
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	LabelPriority = "priority" // SRV记录优先级的元数据key
+)
+
+// DNSResolver 通过DNS解析实例，Service 不为空时查询SRV记录，否则查询A记录并使用 Port
+type DNSResolver struct {
+	Host     string        // 域名
+	Port     int64         // A记录使用的端口
+	Service  string        // SRV服务名，如 http
+	Proto    string        // SRV协议，如 tcp
+	Resolver *net.Resolver // 为空时使用 net.DefaultResolver
+}
+
+// NewDNSResolver 创建A记录数据源
+func NewDNSResolver(host string, port int64) *DNSResolver {
+	return &DNSResolver{Host: host, Port: port}
+}
+
+// NewSRVResolver 创建SRV记录数据源，查询 _service._proto.host
+func NewSRVResolver(service, proto, host string) *DNSResolver {
+	return &DNSResolver{Host: host, Service: service, Proto: proto}
+}
+
+func (r *DNSResolver) Resolve(ctx context.Context) ([]*Instance, error) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if r.Service != "" {
+		return r.resolveSRV(ctx, resolver)
+	}
+
+	ips, err := resolver.LookupIP(ctx, "ip4", r.Host)
+	if err != nil {
+		return nil, err
+	}
+	instanceList := make([]*Instance, 0, len(ips))
+	for _, ip := range ips {
+		instanceList = append(instanceList, NewInstance(ip.String(), r.Port, 1))
+	}
+	return instanceList, nil
+}
+
+// resolveSRV SRV记录的权重为0时按1处理，优先级记录在元数据中
+func (r *DNSResolver) resolveSRV(ctx context.Context, resolver *net.Resolver) ([]*Instance, error) {
+	_, records, err := resolver.LookupSRV(ctx, r.Service, r.Proto, r.Host)
+	if err != nil {
+		return nil, err
+	}
+	instanceList := make([]*Instance, 0, len(records))
+	for _, srv := range records {
+		weight := int64(srv.Weight)
+		if weight == 0 {
+			weight = 1
+		}
+		inst := NewInstance(strings.TrimSuffix(srv.Target, "."), int64(srv.Port), weight)
+		instanceList = append(instanceList, inst.WithLabels(map[string]string{
+			LabelPriority: strconv.Itoa(int(srv.Priority)),
+		}))
+	}
+	return instanceList, nil
+}
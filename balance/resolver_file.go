@@ -0,0 +1,97 @@
+package balance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileResolver 从YAML/JSON文件读取实例，文件修改后重新加载，扩展名为 .json 时按JSON解析，否则按YAML解析
+//
+//	instances:
+//	  - ip: 10.0.0.1
+//	    port: 8080
+//	    weight: 2
+//	    labels:
+//	      zone: a
+type FileResolver struct {
+	Path string
+
+	lock      sync.Mutex
+	modTime   time.Time
+	size      int64
+	instances []*Instance
+}
+
+// instanceFile 实例文件格式
+type instanceFile struct {
+	Instances []instanceConfig `yaml:"instances" json:"instances"`
+}
+
+type instanceConfig struct {
+	Ip     string            `yaml:"ip" json:"ip"`
+	Port   int64             `yaml:"port" json:"port"`
+	Weight *int64            `yaml:"weight" json:"weight"` // 未配置时为1
+	Labels map[string]string `yaml:"labels" json:"labels"`
+}
+
+// NewFileResolver 创建文件数据源
+func NewFileResolver(path string) *FileResolver {
+	return &FileResolver{Path: path}
+}
+
+// Resolve 文件修改时间和大小未变化时直接返回上次解析的结果
+func (r *FileResolver) Resolve(ctx context.Context) ([]*Instance, error) {
+	info, err := os.Stat(r.Path)
+	if err != nil {
+		return nil, fmt.Errorf("os.Stat Error, %s", err.Error())
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.instances != nil && info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return r.instances, nil
+	}
+
+	data, err := ioutil.ReadFile(r.Path)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile Error, %s", err.Error())
+	}
+	instanceList, err := parseInstanceFile(filepath.Ext(r.Path), data)
+	if err != nil {
+		return nil, err
+	}
+	r.modTime, r.size, r.instances = info.ModTime(), info.Size(), instanceList
+	return instanceList, nil
+}
+
+func parseInstanceFile(ext string, data []byte) ([]*Instance, error) {
+	var f instanceFile
+	if ext == ".json" {
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal Error, %s", err.Error())
+		}
+	} else if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("yaml.Unmarshal Error, %s", err.Error())
+	}
+
+	instanceList := make([]*Instance, 0, len(f.Instances))
+	for _, c := range f.Instances {
+		if c.Ip == "" || c.Port <= 0 {
+			return nil, fmt.Errorf("invalid instance %s:%d", c.Ip, c.Port)
+		}
+		var weight int64 = 1
+		if c.Weight != nil {
+			weight = *c.Weight
+		}
+		instanceList = append(instanceList, NewInstance(c.Ip, c.Port, weight).WithLabels(c.Labels))
+	}
+	return instanceList, nil
+}
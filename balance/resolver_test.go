@@ -0,0 +1,313 @@
+package balance
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaticResolver_Watcher(t *testing.T) {
+	list := newTestInstances(3)
+	r := NewStaticResolver(list...)
+	p := NewPool(&RoundRobinBalance{})
+	w := NewWatcher(r, p, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitPool(t, p, 3)
+	_, _ = p.DoBalance()
+
+	// 通知后立即刷新，未变化的实例保留原对象
+	r.Set(list[0], NewInstance("10.0.0.2", 8080, 1))
+	waitPool(t, p, 2)
+	if p.Snapshot()[0] != list[0] || p.Snapshot()[1] != list[1] {
+		t.Error("unchanged instance replaced by watcher")
+	}
+}
+
+func TestWatcher_ZeroInterval(t *testing.T) {
+	r := NewStaticResolver(newTestInstances(2)...)
+	p := NewPool(&RoundRobinBalance{})
+	if w := NewWatcher(r, p, 0); w.Interval != defaultRefreshInterval {
+		t.Errorf("interval %s, expected default", w.Interval)
+	}
+
+	w := &Watcher{Resolver: r, Pool: p}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	waitPool(t, p, 2)
+	cancel()
+	<-done
+}
+
+func waitPool(t *testing.T, p *Pool, n int) {
+	for i := 0; i < 100; i++ {
+		if p.Len() == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("pool len %d, expected %d", p.Len(), n)
+}
+
+func TestFileResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "instances.yaml")
+	yamlData := `
+instances:
+  - ip: 10.0.0.1
+    port: 8080
+    labels:
+      zone: a
+  - ip: 10.0.0.2
+    port: 8080
+    weight: 3
+`
+	if err = ioutil.WriteFile(path, []byte(yamlData), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewFileResolver(path)
+	p := NewPool(&RoundRobinBalance{})
+	w := NewWatcher(r, p, time.Hour)
+	if err = w.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	list := p.Snapshot()
+	if len(list) != 2 || list[0].GetZone() != "a" || list[0].GetWeight() != 1 || list[1].GetWeight() != 3 {
+		t.Fatalf("unexpected instances %v", list)
+	}
+
+	// 修改权重沿用原对象
+	yamlData = strings.Replace(yamlData, "weight: 3", "weight: 5", 1)
+	if err = ioutil.WriteFile(path, []byte(yamlData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Second)
+	_ = os.Chtimes(path, future, future)
+	if err = w.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p.Snapshot()[1] != list[1] || list[1].GetWeight() != 5 {
+		t.Error("weight change not applied in place")
+	}
+
+	jsonPath := filepath.Join(dir, "instances.json")
+	jsonData := `{"instances": [{"ip": "10.0.0.3", "port": 80, "weight": 2}]}`
+	if err = ioutil.WriteFile(jsonPath, []byte(jsonData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	instanceList, err := NewFileResolver(jsonPath).Resolve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instanceList) != 1 || instanceList[0].GetAddr() != "10.0.0.3:80" || instanceList[0].GetWeight() != 2 {
+		t.Errorf("unexpected instances %v", instanceList)
+	}
+
+	if err = ioutil.WriteFile(jsonPath, []byte(`{"instances": [{"ip": ""}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewFileResolver(jsonPath).Resolve(context.Background()); err == nil {
+		t.Error("expected error for invalid instance")
+	}
+}
+
+// stubDNS 本地DNS服务，只应答A和SRV查询
+type stubDNS struct {
+	conn net.PacketConn
+	a    map[string][]net.IP
+	srv  map[string][]net.SRV
+}
+
+func newStubDNS(t *testing.T, a map[string][]net.IP, srv map[string][]net.SRV) *stubDNS {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubDNS{conn: conn, a: a, srv: srv}
+	go s.serve()
+	return s
+}
+
+// resolver 所有查询都发往stub服务
+func (s *stubDNS) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+		},
+	}
+}
+
+func (s *stubDNS) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.answer(buf[:n]); resp != nil {
+			_, _ = s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+const (
+	dnsTypeA   = 1
+	dnsTypeSRV = 33
+)
+
+func (s *stubDNS) answer(req []byte) []byte {
+	if len(req) < 12 {
+		return nil
+	}
+	// 解析第一个问题
+	var labels []string
+	off := 12
+	for off < len(req) && req[off] != 0 {
+		l := int(req[off])
+		if off+1+l > len(req) {
+			return nil
+		}
+		labels = append(labels, string(req[off+1:off+1+l]))
+		off += 1 + l
+	}
+	off++
+	if off+4 > len(req) {
+		return nil
+	}
+	name := strings.ToLower(strings.Join(labels, ".")) + "."
+	qtype := binary.BigEndian.Uint16(req[off:])
+	question := req[12 : off+4]
+
+	var answers [][]byte
+	switch qtype {
+	case dnsTypeA:
+		for _, ip := range s.a[name] {
+			answers = append(answers, dnsRR(dnsTypeA, ip.To4()))
+		}
+	case dnsTypeSRV:
+		for _, srv := range s.srv[name] {
+			data := make([]byte, 6)
+			binary.BigEndian.PutUint16(data[0:], srv.Priority)
+			binary.BigEndian.PutUint16(data[2:], srv.Weight)
+			binary.BigEndian.PutUint16(data[4:], srv.Port)
+			answers = append(answers, dnsRR(dnsTypeSRV, append(data, dnsName(srv.Target)...)))
+		}
+	}
+
+	resp := make([]byte, 12, 512)
+	copy(resp, req[:2])
+	binary.BigEndian.PutUint16(resp[2:], 0x8180) // 响应、期望递归、支持递归
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(answers)))
+	resp = append(resp, question...)
+	for _, rr := range answers {
+		resp = append(resp, rr...)
+	}
+	return resp
+}
+
+// dnsRR 资源记录，名称使用指向问题的压缩指针
+func dnsRR(qtype uint16, data []byte) []byte {
+	rr := make([]byte, 12)
+	binary.BigEndian.PutUint16(rr[0:], 0xC00C)
+	binary.BigEndian.PutUint16(rr[2:], qtype)
+	binary.BigEndian.PutUint16(rr[4:], 1)
+	binary.BigEndian.PutUint32(rr[6:], 60)
+	binary.BigEndian.PutUint16(rr[10:], uint16(len(data)))
+	return append(rr, data...)
+}
+
+func dnsName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func TestDNSResolver(t *testing.T) {
+	s := newStubDNS(t, map[string][]net.IP{
+		"api.svc.test.": {net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")},
+	}, map[string][]net.SRV{
+		"_http._tcp.svc.test.": {
+			{Target: "node1.svc.test.", Port: 8080, Priority: 10, Weight: 5},
+			{Target: "node2.svc.test.", Port: 8081, Priority: 20, Weight: 0},
+		},
+	})
+	defer s.conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r := NewDNSResolver("api.svc.test.", 8080)
+	r.Resolver = s.resolver()
+	list, err := r.Resolve(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].GetAddr() != "10.0.0.1:8080" || list[1].GetAddr() != "10.0.0.2:8080" {
+		t.Fatalf("unexpected A instances %v", list)
+	}
+
+	srv := NewSRVResolver("http", "tcp", "svc.test.")
+	srv.Resolver = s.resolver()
+	list, err = srv.Resolve(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("unexpected SRV instances %v", list)
+	}
+	for _, inst := range list {
+		switch inst.GetAddr() {
+		case "node1.svc.test:8080":
+			if inst.GetWeight() != 5 || inst.GetLabel(LabelPriority) != "10" {
+				t.Errorf("unexpected instance %s", inst.GetResult())
+			}
+		case "node2.svc.test:8081":
+			if inst.GetWeight() != 1 || inst.GetLabel(LabelPriority) != "20" {
+				t.Errorf("unexpected instance %s", inst.GetResult())
+			}
+		default:
+			t.Errorf("unexpected instance %s", inst.GetAddr())
+		}
+	}
+
+	// 周期刷新同步到实例池
+	p := NewPool(&RoundRobinBalance{})
+	if err = NewWatcher(r, p, time.Hour).Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if p.Len() != 2 {
+		t.Errorf("pool len %d, expected 2", p.Len())
+	}
+}
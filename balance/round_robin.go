@@ -1,32 +1,39 @@
 package balance
 
 import (
-	"fmt"
+	"context"
+	"sync/atomic"
 )
 
-// 轮询调度算法
+// 轮询调度算法，使用原子计数器，并发安全
 type RoundRobinBalance struct {
-	curIndex int
+	curIndex uint64
 }
 
 func init() {
-	RegisterBalancer("roundrobin", &RoundRobinBalance{})
+	mustRegister("roundrobin", func() Balancer {
+		return &RoundRobinBalance{}
+	})
 }
 
 func (p *RoundRobinBalance) DoBalance(instanceList []*Instance) (*Instance, error) {
-	lens := len(instanceList)
-	if lens == 0 {
-		return nil, fmt.Errorf("no instance found")
-	}
+	return p.Pick(context.Background(), "", instanceList)
+}
 
-	if p.curIndex >= lens {
-		p.curIndex = 0
+func (p *RoundRobinBalance) Pick(ctx context.Context, key string, instanceList []*Instance) (*Instance, error) {
+	if len(instanceList) == 0 {
+		return nil, ErrNoInstance
 	}
-	inst := instanceList[p.curIndex]
+	instanceList, err := availableInstances(instanceList)
+	if err != nil {
+		return nil, err
+	}
+	lens := len(instanceList)
 
-	p.curIndex = (p.curIndex + 1) % lens
+	index := atomic.AddUint64(&p.curIndex, 1) - 1
+	inst := instanceList[index%uint64(lens)]
 
-	inst.CallNums++
+	inst.markPicked()
 
 	return inst, nil
 }
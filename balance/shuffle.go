@@ -1,35 +1,44 @@
 package balance
 
 import (
-	"errors"
+	"context"
 	"math/rand"
-	"time"
 )
 
-// 洗牌算法
+// 洗牌算法，在副本上洗牌，不修改调用方的实例列表
 type Shuffle2Balance struct {
 }
 
 func init() {
-	RegisterBalancer("shuffle", &Shuffle2Balance{})
+	mustRegister("shuffle", func() Balancer {
+		return &Shuffle2Balance{}
+	})
 }
 
 func (p *Shuffle2Balance) DoBalance(instanceList []*Instance) (*Instance, error) {
-	lens := len(instanceList)
-	if lens == 0 {
-		return nil, errors.New("no instance found")
-	}
+	return p.Pick(context.Background(), "", instanceList)
+}
 
-	rand.Seed(time.Now().UnixNano())
+func (p *Shuffle2Balance) Pick(ctx context.Context, key string, instanceList []*Instance) (*Instance, error) {
+	if len(instanceList) == 0 {
+		return nil, ErrNoInstance
+	}
+	instanceList, err := availableInstances(instanceList)
+	if err != nil {
+		return nil, err
+	}
+	lens := len(instanceList)
 
+	shuffled := make([]*Instance, lens)
+	copy(shuffled, instanceList)
 	for i := lens; i > 0; i-- {
 		lastIdx := i - 1
 		idx := rand.Intn(i)
-		instanceList[lastIdx], instanceList[idx] = instanceList[idx], instanceList[lastIdx]
+		shuffled[lastIdx], shuffled[idx] = shuffled[idx], shuffled[lastIdx]
 	}
 
-	inst := instanceList[0]
-	inst.CallNums++
+	inst := shuffled[0]
+	inst.markPicked()
 
 	return inst, nil
 }
@@ -0,0 +1,109 @@
+package balance
+
+import (
+	"context"
+	"sync"
+)
+
+// 平滑加权轮询算法（nginx smooth weighted round-robin）
+// 每次选择时所有实例的 current 加上 effective，选出 current 最大的实例并减去总权重，
+// 权重为 5,1,1 时选择顺序为 a a b a c a a，不会连续集中到高权重实例
+type SmoothWeightRoundRobinBalance struct {
+	lock   sync.Mutex
+	states map[string]*smoothWeight // 实例地址 -> 权重状态
+}
+
+// smoothWeight 单个实例的轮询状态
+type smoothWeight struct {
+	weight    int64 // 最近一次看到的配置权重
+	effective int64 // 有效权重
+	current   int64 // 当前权重
+}
+
+func init() {
+	mustRegister("smooth_weight_roundrobin", func() Balancer {
+		return &SmoothWeightRoundRobinBalance{}
+	})
+}
+
+func (p *SmoothWeightRoundRobinBalance) DoBalance(instanceList []*Instance) (*Instance, error) {
+	return p.Pick(context.Background(), "", instanceList)
+}
+
+func (p *SmoothWeightRoundRobinBalance) Pick(ctx context.Context, key string, instanceList []*Instance) (*Instance, error) {
+	if len(instanceList) == 0 {
+		return nil, ErrNoInstance
+	}
+	instanceList, err := availableInstances(instanceList)
+	if err != nil {
+		return nil, err
+	}
+
+	// 全部实例权重都不大于0时按相同权重轮询
+	equal := true
+	for _, inst := range instanceList {
+		if inst.GetWeight() > 0 {
+			equal = false
+			break
+		}
+	}
+
+	p.lock.Lock()
+	if p.states == nil {
+		p.states = make(map[string]*smoothWeight, len(instanceList))
+	}
+
+	var (
+		best  *Instance
+		bestS *smoothWeight
+		total int64
+	)
+	for _, inst := range instanceList {
+		w := inst.GetWeight()
+		if equal {
+			w = 1
+		}
+		if w <= 0 {
+			continue
+		}
+
+		s, ok := p.states[inst.GetAddr()]
+		if !ok {
+			s = &smoothWeight{weight: w, effective: w}
+			p.states[inst.GetAddr()] = s
+		} else if s.weight != w {
+			// 权重在运行期间被调整，只更新有效权重，保留当前权重，不打乱轮询顺序
+			s.weight = w
+			s.effective = w
+		}
+
+		s.current += s.effective
+		total += s.effective
+		if bestS == nil || s.current > bestS.current {
+			best, bestS = inst, s
+		}
+	}
+	bestS.current -= total
+	p.prune(instanceList)
+	p.lock.Unlock()
+
+	best.markPicked()
+
+	return best, nil
+}
+
+// prune 清理已不在实例列表中的状态
+func (p *SmoothWeightRoundRobinBalance) prune(instanceList []*Instance) {
+	if len(p.states) <= len(instanceList) {
+		return
+	}
+	alive := make(map[string]struct{}, len(instanceList))
+	for _, inst := range instanceList {
+		alive[inst.GetAddr()] = struct{}{}
+	}
+	for addr := range p.states {
+		if _, ok := alive[addr]; !ok {
+			delete(p.states, addr)
+		}
+	}
+}
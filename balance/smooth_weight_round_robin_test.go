@@ -0,0 +1,74 @@
+package balance
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSmoothWeightRoundRobin_Sequence(t *testing.T) {
+	a := NewInstance("a", 80, 5)
+	b := NewInstance("b", 80, 1)
+	c := NewInstance("c", 80, 1)
+	list := []*Instance{a, b, c}
+
+	p := &SmoothWeightRoundRobinBalance{}
+	var seq []string
+	for i := 0; i < 14; i++ {
+		inst, err := p.DoBalance(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seq = append(seq, inst.GetHost())
+	}
+	if got := strings.Join(seq, ""); got != "aabacaaaabacaa" {
+		t.Errorf("unexpected sequence %s", got)
+	}
+}
+
+func TestSmoothWeightRoundRobin_SetWeight(t *testing.T) {
+	list := newTestInstances(2)
+	list[0].SetWeight(1)
+	list[1].SetWeight(1)
+
+	p := &SmoothWeightRoundRobinBalance{}
+	for i := 0; i < 10; i++ {
+		_, _ = p.DoBalance(list)
+	}
+	if list[0].GetCallTimes() != 5 || list[1].GetCallTimes() != 5 {
+		t.Fatalf("unexpected distribution %s %s", list[0].GetResult(), list[1].GetResult())
+	}
+
+	list[1].SetWeight(3)
+	for i := 0; i < 40; i++ {
+		_, _ = p.DoBalance(list)
+	}
+	if list[0].GetCallTimes() != 15 || list[1].GetCallTimes() != 35 {
+		t.Errorf("unexpected distribution %s %s", list[0].GetResult(), list[1].GetResult())
+	}
+}
+
+func TestSmoothWeightRoundRobin_ZeroWeight(t *testing.T) {
+	list := newTestInstances(3)
+	list[0].SetWeight(0)
+	p := &SmoothWeightRoundRobinBalance{}
+	for i := 0; i < 10; i++ {
+		inst, _ := p.DoBalance(list)
+		if inst == list[0] {
+			t.Fatal("picked instance with zero weight")
+		}
+	}
+
+	for _, inst := range list {
+		inst.SetWeight(0)
+	}
+	if _, err := p.DoBalance(list); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetGCD(t *testing.T) {
+	list := []*Instance{NewInstance("a", 80, 4), NewInstance("b", 80, 8), NewInstance("c", 80, 6)}
+	if g := getGCD(list); g != 2 {
+		t.Errorf("gcd %d, expected 2", g)
+	}
+}
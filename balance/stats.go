@@ -0,0 +1,218 @@
+package balance
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets 耗时直方图的上界
+var latencyBuckets = [...]time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// latencyBucket 耗时所在的直方图下标
+func latencyBucket(d time.Duration) int {
+	return sort.Search(len(latencyBuckets), func(i int) bool {
+		return d <= latencyBuckets[i]
+	})
+}
+
+// LatencyBucket 直方图的一个桶，Count 为耗时不大于 UpperBound 的累计次数
+type LatencyBucket struct {
+	UpperBound time.Duration // 最后一个桶为0，表示+Inf
+	Count      int64
+}
+
+// InstanceStats 实例统计快照
+type InstanceStats struct {
+	Addr     string
+	Labels   map[string]string
+	Picks    int64         // 被选中次数
+	Failures int64         // 累计失败次数
+	Inflight int64         // 正在处理的请求数
+	Latency  time.Duration // EWMA延迟
+	Healthy  bool          // 主动探测通过且未被摘除
+	Ejected  bool          // 被动摘除
+	Breaker  BreakerState  // 熔断器状态
+	Limited  bool          // 令牌桶已空
+
+	LatencyBuckets []LatencyBucket
+	LatencyCount   int64
+	LatencySum     time.Duration
+}
+
+// Stats 获取实例统计快照
+func (i *Instance) Stats() InstanceStats {
+	s := InstanceStats{
+		Addr:           i.GetAddr(),
+		Labels:         i.Labels,
+		Picks:          i.GetCallTimes(),
+		Failures:       atomic.LoadInt64(&i.failureTotal),
+		Inflight:       i.GetInflight(),
+		Latency:        i.GetLatency(),
+		Healthy:        i.IsHealthy(),
+		Ejected:        i.IsEjected(),
+		Breaker:        i.GetBreakerState(),
+		Limited:        i.IsRateLimited(),
+		LatencyBuckets: make([]LatencyBucket, 0, len(i.latencyHist)),
+		LatencySum:     time.Duration(atomic.LoadInt64(&i.latencySum)),
+	}
+	for b := range i.latencyHist {
+		s.LatencyCount += atomic.LoadInt64(&i.latencyHist[b])
+		var bound time.Duration
+		if b < len(latencyBuckets) {
+			bound = latencyBuckets[b]
+		}
+		s.LatencyBuckets = append(s.LatencyBuckets, LatencyBucket{UpperBound: bound, Count: s.LatencyCount})
+	}
+	return s
+}
+
+// Stats 获取实例池中所有实例的统计快照
+func (p *Pool) Stats() []InstanceStats {
+	instanceList := p.load()
+	stats := make([]InstanceStats, 0, len(instanceList))
+	for _, inst := range instanceList {
+		stats = append(stats, inst.Stats())
+	}
+	return stats
+}
+
+// StatsHandler 以Prometheus文本格式输出实例池统计
+type StatsHandler struct {
+	lock  sync.RWMutex
+	pools map[string]*Pool
+}
+
+// NewStatsHandler 创建统计输出
+func NewStatsHandler() *StatsHandler {
+	return &StatsHandler{pools: make(map[string]*Pool)}
+}
+
+// Register 注册实例池，name 作为 pool 标签输出
+func (h *StatsHandler) Register(name string, pool *Pool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.pools == nil {
+		h.pools = make(map[string]*Pool)
+	}
+	h.pools[name] = pool
+}
+
+// Unregister 注销实例池
+func (h *StatsHandler) Unregister(name string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.pools, name)
+}
+
+type poolStats struct {
+	name  string
+	stats []InstanceStats
+}
+
+func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lock.RLock()
+	all := make([]poolStats, 0, len(h.pools))
+	for name, pool := range h.pools {
+		stats := pool.Stats()
+		sort.Slice(stats, func(i, j int) bool {
+			return stats[i].Addr < stats[j].Addr
+		})
+		all = append(all, poolStats{name: name, stats: stats})
+	}
+	h.lock.RUnlock()
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].name < all[j].name
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+
+	metric := func(name, typ, help string, value func(s *InstanceStats) float64) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, p := range all {
+			for i := range p.stats {
+				fmt.Fprintf(bw, "%s{%s} %s\n", name, instanceLabels(p.name, &p.stats[i]), formatFloat(value(&p.stats[i])))
+			}
+		}
+	}
+	metric("balance_instance_picks_total", "counter", "Number of times the instance was picked.",
+		func(s *InstanceStats) float64 { return float64(s.Picks) })
+	metric("balance_instance_failures_total", "counter", "Number of failed calls reported for the instance.",
+		func(s *InstanceStats) float64 { return float64(s.Failures) })
+	metric("balance_instance_inflight", "gauge", "Number of in-flight calls to the instance.",
+		func(s *InstanceStats) float64 { return float64(s.Inflight) })
+	metric("balance_instance_healthy", "gauge", "Whether the instance is healthy (1) or not (0).",
+		func(s *InstanceStats) float64 { return boolFloat(s.Healthy) })
+	metric("balance_instance_ejected", "gauge", "Whether the instance is passively ejected (1) or not (0).",
+		func(s *InstanceStats) float64 { return boolFloat(s.Ejected) })
+	metric("balance_instance_breaker_state", "gauge", "Circuit breaker state: 0 closed, 1 open, 2 half-open.",
+		func(s *InstanceStats) float64 { return float64(s.Breaker) })
+	metric("balance_instance_rate_limited", "gauge", "Whether the instance token bucket is empty (1) or not (0).",
+		func(s *InstanceStats) float64 { return boolFloat(s.Limited) })
+	metric("balance_instance_latency_ewma_seconds", "gauge", "EWMA latency of calls to the instance.",
+		func(s *InstanceStats) float64 { return s.Latency.Seconds() })
+
+	const hist = "balance_instance_latency_seconds"
+	fmt.Fprintf(bw, "# HELP %s Latency of calls to the instance.\n# TYPE %s histogram\n", hist, hist)
+	for _, p := range all {
+		for i := range p.stats {
+			s := &p.stats[i]
+			labels := instanceLabels(p.name, s)
+			for _, b := range s.LatencyBuckets {
+				le := "+Inf"
+				if b.UpperBound > 0 {
+					le = formatFloat(b.UpperBound.Seconds())
+				}
+				fmt.Fprintf(bw, "%s_bucket{%s,le=\"%s\"} %d\n", hist, labels, le, b.Count)
+			}
+			fmt.Fprintf(bw, "%s_sum{%s} %s\n", hist, labels, formatFloat(s.LatencySum.Seconds()))
+			fmt.Fprintf(bw, "%s_count{%s} %d\n", hist, labels, s.LatencyCount)
+		}
+	}
+}
+
+// instanceLabels 实例的Prometheus标签，zone 元数据一并输出
+func instanceLabels(pool string, s *InstanceStats) string {
+	labels := fmt.Sprintf(`pool="%s",instance="%s"`, escapeLabel(pool), escapeLabel(s.Addr))
+	if zone := s.Labels[LabelZone]; zone != "" {
+		labels += fmt.Sprintf(`,zone="%s"`, escapeLabel(zone))
+	}
+	return labels
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
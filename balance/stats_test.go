@@ -0,0 +1,69 @@
+package balance
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstance_Stats(t *testing.T) {
+	inst := NewInstance("10.0.0.1", 80, 1)
+	inst.ObserveLatency(3 * time.Millisecond)
+	inst.ObserveLatency(40 * time.Millisecond)
+	inst.ObserveLatency(time.Minute)
+	inst.ReportFailure()
+	inst.Acquire()
+
+	s := inst.Stats()
+	if s.Failures != 1 || s.Inflight != 1 || !s.Healthy || s.LatencyCount != 3 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if s.LatencySum != time.Minute+43*time.Millisecond {
+		t.Errorf("latency sum %s", s.LatencySum)
+	}
+	buckets := s.LatencyBuckets
+	if len(buckets) != len(latencyBuckets)+1 {
+		t.Fatalf("%d buckets", len(buckets))
+	}
+	if buckets[0].Count != 1 || buckets[3].Count != 2 || buckets[len(buckets)-2].Count != 2 || buckets[len(buckets)-1].Count != 3 {
+		t.Errorf("unexpected buckets %v", buckets)
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	list := newTestInstances(2)
+	list[0].WithLabels(map[string]string{LabelZone: `a"b`})
+	pool := NewPool(&RoundRobinBalance{}, list...)
+	for i := 0; i < 3; i++ {
+		_, _ = pool.DoBalance()
+	}
+	list[1].ObserveLatency(20 * time.Millisecond)
+	list[1].SetProbeResult(false)
+
+	h := NewStatsHandler()
+	h.Register("user", pool)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type %s", ct)
+	}
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE balance_instance_picks_total counter",
+		`balance_instance_picks_total{pool="user",instance="10.0.0.1:8080",zone="a\"b"} 2`,
+		`balance_instance_picks_total{pool="user",instance="10.0.0.2:8080"} 1`,
+		`balance_instance_healthy{pool="user",instance="10.0.0.2:8080"} 0`,
+		`balance_instance_latency_ewma_seconds{pool="user",instance="10.0.0.2:8080"} 0.02`,
+		"# TYPE balance_instance_latency_seconds histogram",
+		`balance_instance_latency_seconds_bucket{pool="user",instance="10.0.0.2:8080",le="0.01"} 0`,
+		`balance_instance_latency_seconds_bucket{pool="user",instance="10.0.0.2:8080",le="0.025"} 1`,
+		`balance_instance_latency_seconds_bucket{pool="user",instance="10.0.0.2:8080",le="+Inf"} 1`,
+		`balance_instance_latency_seconds_count{pool="user",instance="10.0.0.2:8080"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing line %s", line)
+		}
+	}
+}
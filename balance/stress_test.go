@@ -0,0 +1,126 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+)
+
+// 并发压力测试，建议使用 go test -race 运行
+
+const (
+	stressWorkers = 8
+	stressPicks   = 5000
+)
+
+// stress 并发调用Pick，返回每个实例被选中的次数
+func stress(t *testing.T, b Balancer, list []*Instance) map[*Instance]int64 {
+	var wg sync.WaitGroup
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < stressPicks; i++ {
+				key := fmt.Sprintf("key-%d-%d", w, i)
+				if _, err := b.Pick(context.Background(), key, list); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	counts := make(map[*Instance]int64, len(list))
+	var total int64
+	for _, inst := range list {
+		counts[inst] = inst.GetCallTimes()
+		total += counts[inst]
+	}
+	if total != stressWorkers*stressPicks {
+		t.Errorf("total call nums %d, expected %d", total, stressWorkers*stressPicks)
+	}
+	return counts
+}
+
+// checkFair 检查每个实例的选中次数与期望值的偏差不超过tolerance
+func checkFair(t *testing.T, name string, counts map[*Instance]int64, list []*Instance, tolerance float64) {
+	var totalWeight int64
+	for _, inst := range list {
+		totalWeight += inst.Weight
+	}
+	for _, inst := range list {
+		expected := float64(stressWorkers*stressPicks) * float64(inst.Weight) / float64(totalWeight)
+		if diff := math.Abs(float64(counts[inst])-expected) / expected; diff > tolerance {
+			t.Errorf("%s: %s picked %d times, expected %.0f", name, inst.GetAddr(), counts[inst], expected)
+		}
+	}
+}
+
+func TestStress_Uniform(t *testing.T) {
+	tests := []struct {
+		name      string
+		balancer  Balancer
+		tolerance float64
+	}{
+		{"roundrobin", &RoundRobinBalance{}, 0},
+		{"random", &RandomBalance{}, 0.1},
+		{"shuffle", &Shuffle2Balance{}, 0.1},
+		{"hash", NewHashBalance(0), 0.25},
+	}
+	for _, tt := range tests {
+		list := newTestInstances(4)
+		counts := stress(t, tt.balancer, list)
+		checkFair(t, tt.name, counts, list, tt.tolerance)
+	}
+}
+
+func TestStress_Weighted(t *testing.T) {
+	list := newTestInstances(4)
+	for i, inst := range list {
+		inst.Weight = int64(i + 1)
+	}
+	counts := stress(t, &WeightRoundRobinBalance{}, list)
+	checkFair(t, "weight_roundrobin", counts, list, 0.01)
+
+	list = newTestInstances(4)
+	for i, inst := range list {
+		inst.Weight = int64(i + 1)
+	}
+	counts = stress(t, &SmoothWeightRoundRobinBalance{}, list)
+	checkFair(t, "smooth_weight_roundrobin", counts, list, 0.01)
+}
+
+func TestStress_Shared(t *testing.T) {
+	// 多个goroutine通过全局管理器共享同一个实例列表
+	list := newTestInstances(4)
+	var wg sync.WaitGroup
+	for _, name := range ListBalancers() {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for i := 0; i < stressPicks; i++ {
+				if _, err := DoBalance(name, list); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(name)
+	}
+	wg.Wait()
+}
+
+func TestShuffle_KeepOrder(t *testing.T) {
+	list := newTestInstances(5)
+	origin := append([]*Instance{}, list...)
+	for i := 0; i < 100; i++ {
+		_, _ = (&Shuffle2Balance{}).DoBalance(list)
+	}
+	for i := range list {
+		if list[i] != origin[i] {
+			t.Fatal("shuffle reordered the caller's instance list")
+		}
+	}
+}
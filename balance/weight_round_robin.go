@@ -1,31 +1,46 @@
 package balance
 
 import (
-	"fmt"
+	"context"
+	"sync"
 )
 
-// 带权重的轮询调度算法
+// 带权重的轮询调度算法，Index/Weight 由 lock 保护
 type WeightRoundRobinBalance struct {
 	Index  int64
 	Weight int64
+
+	lock sync.Mutex
 }
 
 func init() {
-	RegisterBalancer("weight_roundrobin", &WeightRoundRobinBalance{})
+	mustRegister("weight_roundrobin", func() Balancer {
+		return &WeightRoundRobinBalance{}
+	})
 }
 
 func (p *WeightRoundRobinBalance) DoBalance(instanceList []*Instance) (*Instance, error) {
-	lens := len(instanceList)
-	if lens == 0 {
-		return nil, fmt.Errorf("no instance found")
+	return p.Pick(context.Background(), "", instanceList)
+}
+
+func (p *WeightRoundRobinBalance) Pick(ctx context.Context, key string, instanceList []*Instance) (*Instance, error) {
+	if len(instanceList) == 0 {
+		return nil, ErrNoInstance
+	}
+	instanceList, err := availableInstances(instanceList)
+	if err != nil {
+		return nil, err
 	}
 
+	p.lock.Lock()
 	inst := p.GetInst(instanceList)
-	inst.CallNums++
+	p.lock.Unlock()
+	inst.markPicked()
 
 	return inst, nil
 }
 
+// GetInst 非并发安全，调用方需自行加锁
 func (p *WeightRoundRobinBalance) GetInst(instanceList []*Instance) *Instance {
 	gcd := getGCD(instanceList)
 	for {
@@ -40,7 +55,7 @@ func (p *WeightRoundRobinBalance) GetInst(instanceList []*Instance) *Instance {
 			}
 		}
 
-		if instanceList[p.Index].Weight >= p.Weight {
+		if instanceList[p.Index].GetWeight() >= p.Weight {
 			return instanceList[p.Index]
 		}
 	}
@@ -59,11 +74,11 @@ func getGCD(instanceList []*Instance) int64 {
 	var weights []int64
 
 	for _, instance := range instanceList {
-		weights = append(weights, instance.Weight)
+		weights = append(weights, instance.GetWeight())
 	}
 
 	g := weights[0]
-	for i := 1; i < len(weights)-1; i++ {
+	for i := 1; i < len(weights); i++ {
 		oldGcd := g
 		g = gcd(oldGcd, weights[i])
 	}
@@ -74,8 +89,8 @@ func getGCD(instanceList []*Instance) int64 {
 func getMaxWeight(instanceList []*Instance) int64 {
 	var max int64 = 0
 	for _, instance := range instanceList {
-		if instance.Weight >= int64(max) {
-			max = instance.Weight
+		if w := instance.GetWeight(); w >= max {
+			max = w
 		}
 	}
 
@@ -0,0 +1,229 @@
+package whttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/shhnwangjian/toolpkg/balance"
+)
+
+const (
+	defaultMaxAttempts = 3
+)
+
+type balanceKey struct{}
+
+// WithBalanceKey 指定负载均衡使用的key，如用户ID、会话ID
+func WithBalanceKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, balanceKey{}, key)
+}
+
+func balanceKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(balanceKey{}).(string)
+	return key
+}
+
+// BalancedClient 按服务名发起请求，path中的host为服务名，如 http://user-service/v1/users，
+// 每次尝试通过服务对应实例池的负载均衡选择实例，失败后换一个实例重试，
+// 并向实例上报请求数、耗时、成功与失败
+type BalancedClient struct {
+	Client      *Client // 发起请求的客户端，为空时使用默认客户端
+	MaxAttempts int     // 最大尝试次数，<=0 时使用默认值
+
+	lock  sync.RWMutex
+	pools map[string]*balance.Pool
+}
+
+// NewBalancedClient 创建负载均衡客户端
+func NewBalancedClient() *BalancedClient {
+	return &BalancedClient{
+		MaxAttempts: defaultMaxAttempts,
+		pools:       make(map[string]*balance.Pool),
+	}
+}
+
+// Register 注册服务名对应的实例池
+func (c *BalancedClient) Register(service string, pool *balance.Pool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.pools == nil {
+		c.pools = make(map[string]*balance.Pool)
+	}
+	c.pools[service] = pool
+}
+
+// Unregister 注销服务
+func (c *BalancedClient) Unregister(service string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.pools, service)
+}
+
+func (c *BalancedClient) pool(service string) (*balance.Pool, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	pool, ok := c.pools[service]
+	if !ok {
+		return nil, fmt.Errorf("service %s not registered", service)
+	}
+	return pool, nil
+}
+
+func (c *BalancedClient) Get(ctx context.Context, path, body string, header http.Header, timeout uint64,
+	params map[string]string) (response *http.Response, err error) {
+	return c.Request(ctx, http.MethodGet, path, body, header, timeout, params)
+}
+
+func (c *BalancedClient) Post(ctx context.Context, path, body string, header http.Header, timeout uint64,
+	params map[string]string) (response *http.Response, err error) {
+	return c.Request(ctx, http.MethodPost, path, body, header, timeout, params)
+}
+
+func (c *BalancedClient) Put(ctx context.Context, path, body string, header http.Header, timeout uint64,
+	params map[string]string) (response *http.Response, err error) {
+	return c.Request(ctx, http.MethodPut, path, body, header, timeout, params)
+}
+
+func (c *BalancedClient) Delete(ctx context.Context, path, body string, header http.Header, timeout uint64,
+	params map[string]string) (response *http.Response, err error) {
+	return c.Request(ctx, http.MethodDelete, path, body, header, timeout, params)
+}
+
+func (c *BalancedClient) Patch(ctx context.Context, path, body string, header http.Header, timeout uint64,
+	params map[string]string) (response *http.Response, err error) {
+	return c.Request(ctx, http.MethodPatch, path, body, header, timeout, params)
+}
+
+func (c *BalancedClient) ResponseBody(ctx context.Context, method, path, body string, header http.Header, timeout uint64,
+	params map[string]string) (int, []byte, error) {
+	response, err := c.Request(ctx, method, path, body, header, timeout, params)
+	if err != nil {
+		return 0, nil, err
+	}
+	bytes, err := ioutil.ReadAll(response.Body)
+	defer response.Body.Close()
+	return response.StatusCode, bytes, err
+}
+
+func (c *BalancedClient) GetHttpClient(timeout uint64) *http.Client {
+	return c.client().GetHttpClient(timeout)
+}
+
+func (c *BalancedClient) client() *Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return defaultClient
+}
+
+// Request 发起请求，连接失败或响应5xx时，幂等方法换一个实例重试
+func (c *BalancedClient) Request(ctx context.Context, method, path, body string, header http.Header, timeout uint64,
+	params map[string]string) (response *http.Response, err error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := c.pool(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := c.MaxAttempts
+	if attempts <= 0 {
+		attempts = defaultMaxAttempts
+	}
+	if !isIdempotent(method) {
+		attempts = 1
+	}
+
+	key := balanceKeyFromContext(ctx)
+	tried := make(map[*balance.Instance]struct{}, attempts)
+	for i := 0; i < attempts; i++ {
+		inst, pickErr := pickUntried(ctx, pool, key, tried)
+		if pickErr != nil {
+			if err == nil {
+				err = pickErr
+			}
+			return response, err
+		}
+		tried[inst] = struct{}{}
+
+		if response != nil {
+			response.Body.Close()
+		}
+		response, err = c.attempt(ctx, inst, *u, method, body, header, timeout, params)
+		if err == nil && response.StatusCode < http.StatusInternalServerError {
+			return response, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return response, err
+}
+
+// attempt 向选中的实例发起一次请求并上报结果
+func (c *BalancedClient) attempt(ctx context.Context, inst *balance.Instance, u url.URL, method, body string,
+	header http.Header, timeout uint64, params map[string]string) (*http.Response, error) {
+	u.Host = inst.GetAddr()
+
+	inst.Acquire()
+	start := time.Now()
+	response, err := c.client().Request(ctx, method, u.String(), body, header, timeout, params)
+	inst.ObserveLatency(time.Since(start))
+	if err != nil || response.StatusCode >= http.StatusInternalServerError {
+		inst.ReportFailure()
+	} else {
+		inst.ReportSuccess()
+	}
+	if err != nil {
+		inst.Release()
+		return nil, err
+	}
+
+	// 响应体关闭后才释放请求槽位
+	response.Body = &releaseBody{ReadCloser: response.Body, inst: inst}
+	return response, nil
+}
+
+// pickUntried 首次按负载均衡算法选择，重试时在未尝试过的实例中确定性地选择，
+// 不影响hash查找表和平滑加权轮询的状态，全部实例都尝试过时按负载均衡算法选择
+func pickUntried(ctx context.Context, pool *balance.Pool, key string,
+	tried map[*balance.Instance]struct{}) (*balance.Instance, error) {
+	if len(tried) == 0 {
+		return pool.Pick(ctx, key)
+	}
+	inst, err := pool.PickExcept(key, tried)
+	if errors.Is(err, balance.ErrNoInstance) {
+		return pool.Pick(ctx, key)
+	}
+	return inst, err
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// releaseBody 关闭时释放实例的请求槽位
+type releaseBody struct {
+	io.ReadCloser
+	inst *balance.Instance
+	once sync.Once
+}
+
+func (b *releaseBody) Close() error {
+	b.once.Do(b.inst.Release)
+	return b.ReadCloser.Close()
+}
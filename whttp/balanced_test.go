@@ -0,0 +1,179 @@
+package whttp
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/shhnwangjian/toolpkg/balance"
+)
+
+func newTestInstance(t *testing.T, ts *httptest.Server) *balance.Instance {
+	host, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.ParseInt(port, 10, 64)
+	return balance.NewInstance(host, p, 1)
+}
+
+func TestBalancedClient_Retry(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path + "?" + r.URL.RawQuery))
+	}))
+	defer ok.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+
+	good, failing := newTestInstance(t, ok), newTestInstance(t, bad)
+	c := NewBalancedClient()
+	c.Register("user-service", balance.NewPool(&balance.RoundRobinBalance{}, failing, good))
+
+	for i := 0; i < 4; i++ {
+		code, body, err := c.ResponseBody(context.Background(), http.MethodGet, "http://user-service/v1/users",
+			"", http.Header{}, 5, map[string]string{"id": "1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != http.StatusOK || string(body) != "/v1/users?id=1" {
+			t.Fatalf("unexpected response %d %s", code, body)
+		}
+	}
+	// 重试不推进轮询游标，失败实例每两次请求被选中一次
+	if good.GetCallTimes() != 4 || failing.GetCallTimes() != 2 {
+		t.Errorf("unexpected picks %s %s", good.GetResult(), failing.GetResult())
+	}
+	if good.GetInflight() != 0 || failing.GetInflight() != 0 {
+		t.Error("inflight not released")
+	}
+	if good.GetLatency() == 0 {
+		t.Error("latency not recorded")
+	}
+
+	// 非幂等方法不重试，第5次连续失败后实例被摘除
+	for i := 0; i < 6; i++ {
+		resp, err := c.Post(context.Background(), "http://user-service/v1/users", "{}", http.Header{}, 5, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if good.GetCallTimes() != 7 || failing.GetCallTimes() != 5 {
+		t.Fatalf("post retried: %s %s", good.GetResult(), failing.GetResult())
+	}
+	if failing.IsHealthy() {
+		t.Fatal("failing instance not ejected")
+	}
+	for i := 0; i < 4; i++ {
+		_, _, _ = c.ResponseBody(context.Background(), http.MethodGet, "http://user-service/", "", http.Header{}, 5, nil)
+	}
+	if good.GetCallTimes() != 11 || failing.GetCallTimes() != 5 {
+		t.Errorf("ejected instance picked: %s %s", good.GetResult(), failing.GetResult())
+	}
+}
+
+func TestBalancedClient_AllFailed(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer bad.Close()
+
+	inst := newTestInstance(t, bad)
+	c := NewBalancedClient()
+	c.Register("svc", balance.NewPool(&balance.RandomBalance{}, inst))
+	resp, err := c.Get(context.Background(), "http://svc/", "", http.Header{}, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || inst.GetCallTimes() != defaultMaxAttempts {
+		t.Errorf("unexpected result %d %s", resp.StatusCode, inst.GetResult())
+	}
+
+	if _, err = c.Get(context.Background(), "http://unknown/", "", http.Header{}, 5, nil); err == nil {
+		t.Error("expected error for unregistered service")
+	}
+}
+
+func TestBalancedClient_Key(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	list := []*balance.Instance{newTestInstance(t, ts)}
+	c := NewBalancedClient()
+	c.Register("svc", balance.NewPool(balance.NewHashBalance(0), list...))
+	ctx := WithBalanceKey(context.Background(), "user-1")
+	_, _, err := c.ResponseBody(ctx, http.MethodGet, "http://svc/", "", http.Header{}, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balanceKeyFromContext(ctx) != "user-1" {
+		t.Error("balance key lost")
+	}
+}
+
+func TestPickUntried(t *testing.T) {
+	a := balance.NewInstance("10.0.0.1", 80, 1)
+	b := balance.NewInstance("10.0.0.2", 80, 1)
+	pool := balance.NewPool(balance.NewHashBalance(0), a, b)
+
+	// 两个实例时重试也必须换到另一个实例，被跳过的实例不计入选择次数
+	first, err := pickUntried(context.Background(), pool, "k", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tried := map[*balance.Instance]struct{}{first: {}}
+	for i := 0; i < 10; i++ {
+		inst, err := pickUntried(context.Background(), pool, "k", tried)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inst == first {
+			t.Fatal("picked the tried instance again")
+		}
+	}
+	if first.GetCallTimes() != 1 {
+		t.Errorf("tried instance picked %d times", first.GetCallTimes())
+	}
+
+	random := balance.NewPool(&balance.RandomBalance{}, a, b)
+	for i := 0; i < 20; i++ {
+		if inst, _ := pickUntried(context.Background(), random, "", map[*balance.Instance]struct{}{a: {}}); inst != b {
+			t.Fatal("random balancer picked the tried instance")
+		}
+	}
+
+	all := map[*balance.Instance]struct{}{a: {}, b: {}}
+	if inst, err := pickUntried(context.Background(), pool, "k", all); err != nil || inst == nil {
+		t.Errorf("no instance when all tried: %v", err)
+	}
+}
+
+func TestBalancedClient_RetryOtherInstance(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+
+	// 两个实例监听同一端口时地址相同，使用不同的主机名区分
+	host, port, _ := net.SplitHostPort(bad.Listener.Addr().String())
+	p, _ := strconv.ParseInt(port, 10, 64)
+	a, b := balance.NewInstance(host, p, 1), balance.NewInstance("localhost", p, 1)
+	c := NewBalancedClient()
+	c.Register("svc", balance.NewPool(balance.NewHashBalance(0), a, b))
+	resp, err := c.Get(WithBalanceKey(context.Background(), "k"), "http://svc/", "", http.Header{}, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if a.GetCallTimes() == 0 || b.GetCallTimes() == 0 || a.GetCallTimes()+b.GetCallTimes() != defaultMaxAttempts {
+		t.Errorf("unexpected picks %s %s", a.GetResult(), b.GetResult())
+	}
+}
@@ -0,0 +1,433 @@
+package whttp
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderFromCache = "X-From-Cache" // 响应来自缓存时为1
+
+	defaultMaxCacheEntryBytes = 10 << 20 // 10MB
+)
+
+// CacheStore 缓存存储，value 为序列化后的响应
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+type noCacheKey struct{}
+
+// WithoutCache 本次请求不读取也不写入缓存
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// Cache GET请求的缓存中间件，按 RFC 7234 处理 Cache-Control、Expires，
+// 过期后使用 ETag/If-None-Match、Last-Modified/If-Modified-Since 重新验证，
+// 304 时返回缓存的响应；请求携带 Cache-Control: no-store 或使用 WithoutCache 时跳过缓存，
+// Range 请求和携带 Authorization、Cookie 的请求也跳过缓存，避免返回部分内容或其他用户的响应，
+// 带 Set-Cookie 或 Cache-Control: private 的响应不缓存，超过10MB的响应不缓存，
+// 非GET请求成功后删除该URL的缓存
+func Cache(store CacheStore) Middleware {
+	return CacheLimit(store, defaultMaxCacheEntryBytes)
+}
+
+// CacheLimit 同 Cache，响应体超过 maxEntryBytes 时不缓存，<=0 使用默认值10MB
+func CacheLimit(store CacheStore, maxEntryBytes int64) Middleware {
+	if maxEntryBytes <= 0 {
+		maxEntryBytes = defaultMaxCacheEntryBytes
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return &cacheTransport{store: store, next: next, maxEntryBytes: maxEntryBytes}
+	}
+}
+
+type cacheTransport struct {
+	store         CacheStore
+	next          http.RoundTripper
+	maxEntryBytes int64
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.String()
+	if req.Method != http.MethodGet {
+		response, err := t.next.RoundTrip(req)
+		if err == nil && req.Method != http.MethodHead && response.StatusCode < http.StatusBadRequest {
+			t.store.Delete(key)
+		}
+		return response, err
+	}
+	reqCC := parseCacheControl(req.Header)
+	if disabled, _ := req.Context().Value(noCacheKey{}).(bool); disabled || reqCC.has("no-store") ||
+		req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" ||
+		req.Header.Get("Range") != "" || req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	cached, storedAt := t.load(key, req)
+	revalidate := false
+	if cached != nil {
+		if !reqCC.has("no-cache") && isFresh(cached, storedAt, reqCC) {
+			cached.Header.Set(HeaderFromCache, "1")
+			return cached, nil
+		}
+		etag, lastModified := cached.Header.Get("ETag"), cached.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			req = req.Clone(req.Context())
+			if etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				req.Header.Set("If-Modified-Since", lastModified)
+			}
+			revalidate = true
+		}
+	}
+
+	response, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if revalidate && response.StatusCode == http.StatusNotModified {
+		_, _ = io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		for name, values := range response.Header {
+			if name != "Content-Length" {
+				cached.Header[name] = values
+			}
+		}
+		body, _ := ioutil.ReadAll(cached.Body)
+		t.save(key, req, cached, body)
+		cached.Body = ioutil.NopCloser(bytes.NewReader(body))
+		cached.Header.Set(HeaderFromCache, "1")
+		return cached, nil
+	}
+	if !isCacheable(reqCC, response) || response.ContentLength > t.maxEntryBytes {
+		if cached != nil {
+			t.store.Delete(key)
+		}
+		return response, nil
+	}
+	// 响应体读取完后写入缓存，超过限制时停止缓冲并删除旧的缓存
+	response.Body = &cachingBody{ReadCloser: response.Body, max: t.maxEntryBytes,
+		done: func(body []byte) {
+			t.save(key, req, response, body)
+		},
+		overflow: func() {
+			t.store.Delete(key)
+		},
+	}
+	return response, nil
+}
+
+// load 读取缓存，Vary 指定的请求头与缓存时不一致时视为未命中
+func (t *cacheTransport) load(key string, req *http.Request) (*http.Response, time.Time) {
+	data, ok := t.store.Get(key)
+	if !ok {
+		return nil, time.Time{}
+	}
+	r := bufio.NewReader(bytes.NewReader(data))
+	storedLine, err1 := r.ReadString('\n')
+	varyLine, err2 := r.ReadString('\n')
+	if err1 != nil || err2 != nil {
+		return nil, time.Time{}
+	}
+	nanos, err := strconv.ParseInt(strings.TrimSpace(storedLine), 10, 64)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	vary, err := url.ParseQuery(strings.TrimSpace(varyLine))
+	if err != nil {
+		return nil, time.Time{}
+	}
+	for name := range vary {
+		if req.Header.Get(name) != vary.Get(name) {
+			return nil, time.Time{}
+		}
+	}
+	response, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	return response, time.Unix(0, nanos)
+}
+
+// save 序列化格式：缓存时间、Vary 请求头、完整响应，各占一行
+func (t *cacheTransport) save(key string, req *http.Request, response *http.Response, body []byte) {
+	vary := url.Values{}
+	for _, name := range headerTokens(response.Header, "Vary") {
+		vary.Set(http.CanonicalHeaderKey(name), req.Header.Get(name))
+	}
+
+	r := *response
+	r.Header = response.Header.Clone()
+	r.Header.Del(HeaderFromCache)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.TransferEncoding = nil
+	dump, err := httputil.DumpResponse(&r, true)
+	if err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d\n%s\n", time.Now().UnixNano(), vary.Encode())
+	buf.Write(dump)
+	t.store.Set(key, buf.Bytes())
+}
+
+// isCacheable 200 响应未禁止缓存、不是私有响应，且有过期时间或验证器时缓存
+func isCacheable(reqCC cacheControl, response *http.Response) bool {
+	if response.StatusCode != http.StatusOK || reqCC.has("no-store") {
+		return false
+	}
+	respCC := parseCacheControl(response.Header)
+	if respCC.has("no-store") || respCC.has("private") || len(response.Header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	for _, name := range headerTokens(response.Header, "Vary") {
+		if name == "*" {
+			return false
+		}
+	}
+	return lifetime(response, respCC, time.Now()) > 0 ||
+		response.Header.Get("ETag") != "" || response.Header.Get("Last-Modified") != ""
+}
+
+// isFresh 缓存的响应是否仍在有效期内，请求的 max-age 可以缩短有效期
+func isFresh(response *http.Response, storedAt time.Time, reqCC cacheControl) bool {
+	respCC := parseCacheControl(response.Header)
+	if respCC.has("no-cache") {
+		return false
+	}
+	maxAge := lifetime(response, respCC, storedAt)
+	if d, ok := reqCC.seconds("max-age"); ok && d < maxAge {
+		maxAge = d
+	}
+	age := time.Since(storedAt)
+	if d, err := strconv.ParseInt(response.Header.Get("Age"), 10, 64); err == nil {
+		age += time.Duration(d) * time.Second
+	}
+	return age < maxAge
+}
+
+// lifetime 优先使用 max-age，否则使用 Expires 与 Date 的差
+func lifetime(response *http.Response, respCC cacheControl, now time.Time) time.Duration {
+	if d, ok := respCC.seconds("max-age"); ok {
+		return d
+	}
+	expires := response.Header.Get("Expires")
+	if expires == "" {
+		return 0
+	}
+	t, err := http.ParseTime(expires)
+	if err != nil {
+		return 0
+	}
+	if date, err := http.ParseTime(response.Header.Get("Date")); err == nil {
+		now = date
+	}
+	return t.Sub(now)
+}
+
+// cacheControl Cache-Control 指令，key 为小写
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, part := range headerTokens(header, "Cache-Control") {
+		name, value := part, ""
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			name, value = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+		cc[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	value, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// headerTokens 按逗号拆分请求头的值
+func headerTokens(header http.Header, name string) []string {
+	var tokens []string
+	for _, value := range header.Values(name) {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// cachingBody 读取到EOF后回调完整的响应体，未读完就关闭或超过 max 时不缓存
+type cachingBody struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	max      int64
+	done     func(body []byte)
+	overflow func()
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.done == nil {
+		return n, err
+	}
+	if int64(b.buf.Len()+n) > b.max {
+		b.buf = bytes.Buffer{}
+		b.done = nil
+		b.overflow()
+		return n, err
+	}
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.done(b.buf.Bytes())
+		b.done = nil
+	}
+	return n, err
+}
+
+// MemoryCache 内存LRU缓存
+type MemoryCache struct {
+	lock       sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCache 创建内存LRU缓存，maxEntries 为最大缓存条数，<=0 表示不限制
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*memoryEntry).value, true
+}
+
+func (c *MemoryCache) Set(key string, value []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*memoryEntry).value = value
+		return
+	}
+	c.items[key] = c.ll.PushFront(&memoryEntry{key: key, value: value})
+	if c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+func (c *MemoryCache) Delete(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.Remove(e)
+		delete(c.items, key)
+	}
+}
+
+// Len 缓存条数
+func (c *MemoryCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.ll.Len()
+}
+
+// DiskCache 磁盘缓存，每个key一个文件，文件名为key的SHA-256
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache 创建磁盘缓存，目录不存在时创建
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("os.MkdirAll Error, %s", err.Error())
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%x", sha256.Sum256([]byte(key))))
+}
+
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Set 先写临时文件再重命名，并发读取时不会读到不完整的内容
+func (c *DiskCache) Set(key string, value []byte) {
+	f, err := ioutil.TempFile(c.dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+func (c *DiskCache) Delete(key string) {
+	os.Remove(c.path(key))
+}
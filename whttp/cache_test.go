@@ -0,0 +1,252 @@
+package whttp
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type cacheResult struct {
+	body      string
+	fromCache bool
+}
+
+func cachedGet(t *testing.T, c *Client, ctx context.Context, url string, header http.Header) cacheResult {
+	resp, err := c.Request(ctx, http.MethodGet, url, "", header, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	return cacheResult{body: string(body), fromCache: resp.Header.Get(HeaderFromCache) == "1"}
+}
+
+func TestCache(t *testing.T) {
+	var calls, notModified int64
+	lastModified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&calls, 1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/etag":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt64(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/modified":
+			w.Header().Set("Last-Modified", lastModified)
+			if r.Header.Get("If-Modified-Since") == lastModified {
+				atomic.AddInt64(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		fmt.Fprintf(w, "%s %d", r.URL.Path, n)
+	}))
+	defer ts.Close()
+
+	c, _ := NewClient(WithMiddleware(Cache(NewMemoryCache(10))))
+	ctx := context.Background()
+
+	first := cachedGet(t, c, ctx, ts.URL+"/fresh", nil)
+	second := cachedGet(t, c, ctx, ts.URL+"/fresh", nil)
+	if first.fromCache || !second.fromCache || first.body != second.body {
+		t.Errorf("fresh response not served from cache %v %v", first, second)
+	}
+	// 按请求禁用缓存、请求要求重新验证
+	if r := cachedGet(t, c, WithoutCache(ctx), ts.URL+"/fresh", nil); r.fromCache || r.body == first.body {
+		t.Errorf("cache not disabled %v", r)
+	}
+	if r := cachedGet(t, c, ctx, ts.URL+"/fresh", http.Header{"Cache-Control": {"no-cache"}}); r.fromCache {
+		t.Errorf("no-cache request served from cache %v", r)
+	}
+
+	for _, path := range []string{"/etag", "/modified"} {
+		first = cachedGet(t, c, ctx, ts.URL+path, nil)
+		second = cachedGet(t, c, ctx, ts.URL+path, nil)
+		if first.fromCache || !second.fromCache || first.body != second.body {
+			t.Errorf("%s not revalidated %v %v", path, first, second)
+		}
+	}
+	if notModified != 2 {
+		t.Errorf("%d 304 responses, expected 2", notModified)
+	}
+
+	first = cachedGet(t, c, ctx, ts.URL+"/nostore", nil)
+	second = cachedGet(t, c, ctx, ts.URL+"/nostore", nil)
+	if second.fromCache || first.body == second.body {
+		t.Error("no-store response cached")
+	}
+
+	// 非GET请求使缓存失效
+	resp, err := c.Request(ctx, http.MethodPost, ts.URL+"/fresh", "", nil, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if r := cachedGet(t, c, ctx, ts.URL+"/fresh", nil); r.fromCache {
+		t.Error("cache not invalidated by POST")
+	}
+}
+
+func TestCache_Bypass(t *testing.T) {
+	var calls int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		switch r.URL.Path {
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/login":
+			w.Header().Set("Set-Cookie", "session=alice")
+		}
+		content := fmt.Sprintf("%s%s %d", r.Header.Get("Authorization"), r.Header.Get("Cookie"), n)
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(content))
+	}))
+	defer ts.Close()
+
+	store := NewMemoryCache(10)
+	c, _ := NewClient(WithMiddleware(Cache(store)))
+	ctx := context.Background()
+	full := cachedGet(t, c, ctx, ts.URL, nil)
+
+	// Range 请求不返回缓存的完整响应，部分内容也不写入缓存
+	resp, err := c.Request(ctx, http.MethodGet, ts.URL, "", http.Header{"Range": {"bytes=0-1"}}, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(body) != " 2" {
+		t.Errorf("unexpected range response %d %q", resp.StatusCode, body)
+	}
+	if r := cachedGet(t, c, ctx, ts.URL, nil); !r.fromCache || r.body != full.body {
+		t.Errorf("cached response replaced by range response %v", r)
+	}
+
+	// 携带凭证的请求不读取也不写入缓存
+	alice := http.Header{"Authorization": {"Bearer alice"}}
+	if r := cachedGet(t, c, ctx, ts.URL, alice); r.fromCache || r.body != "Bearer alice 3" {
+		t.Errorf("credentialed request served from cache %v", r)
+	}
+	if r := cachedGet(t, c, ctx, ts.URL+"/private", alice); r.fromCache {
+		t.Errorf("unexpected cached response %v", r)
+	}
+	if r := cachedGet(t, c, ctx, ts.URL+"/private", nil); r.fromCache {
+		t.Errorf("credentialed response cached %v", r)
+	}
+
+	alice, bob := http.Header{"Cookie": {"session=alice"}}, http.Header{"Cookie": {"session=bob"}}
+	cachedGet(t, c, ctx, ts.URL+"/cookie", alice)
+	if r := cachedGet(t, c, ctx, ts.URL+"/cookie", bob); r.fromCache || !strings.HasPrefix(r.body, "session=bob") {
+		t.Errorf("response for another cookie returned %v", r)
+	}
+	// 私有响应和设置 Cookie 的响应不缓存
+	for _, path := range []string{"/private", "/login"} {
+		cachedGet(t, c, ctx, ts.URL+path, nil)
+		if r := cachedGet(t, c, ctx, ts.URL+path, nil); r.fromCache {
+			t.Errorf("%s response cached %v", path, r)
+		}
+	}
+}
+
+func TestCache_MaxEntry(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		// 分两次写入并 Flush，不设置 Content-Length
+		_, _ = w.Write([]byte(strings.Repeat("a", size/2)))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte(strings.Repeat("a", size-size/2)))
+	}))
+	defer ts.Close()
+
+	store := NewMemoryCache(10)
+	c, _ := NewClient(WithMiddleware(CacheLimit(store, 100)))
+	for _, size := range []int{100, 101} {
+		url := fmt.Sprintf("%s?size=%d", ts.URL, size)
+		cachedGet(t, c, context.Background(), url, nil)
+		r := cachedGet(t, c, context.Background(), url, nil)
+		if len(r.body) != size || r.fromCache != (size <= 100) {
+			t.Errorf("size %d: unexpected cache result %d %v", size, len(r.body), r.fromCache)
+		}
+	}
+}
+
+func TestCache_Vary(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = w.Write([]byte(r.Header.Get("Accept-Language")))
+	}))
+	defer ts.Close()
+
+	c, _ := NewClient(WithMiddleware(Cache(NewMemoryCache(10))))
+	en, zh := http.Header{"Accept-Language": {"en"}}, http.Header{"Accept-Language": {"zh"}}
+	cachedGet(t, c, context.Background(), ts.URL, en)
+	if r := cachedGet(t, c, context.Background(), ts.URL, zh); r.fromCache || r.body != "zh" {
+		t.Errorf("unexpected response %v", r)
+	}
+	if r := cachedGet(t, c, context.Background(), ts.URL, zh); !r.fromCache || r.body != "zh" {
+		t.Errorf("unexpected response %v", r)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	var calls int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		w.Header().Set("Expires", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+		_, _ = w.Write([]byte("disk"))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		store, err := NewDiskCache(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, _ := NewClient(WithMiddleware(Cache(store)))
+		if r := cachedGet(t, c, context.Background(), ts.URL, nil); r.body != "disk" || r.fromCache != (i == 1) {
+			t.Errorf("unexpected response %v", r)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("%d calls, expected 1", calls)
+	}
+}
+
+func TestMemoryCache_LRU(t *testing.T) {
+	c := NewMemoryCache(2)
+	c.Set("a", []byte("1"))
+	c.Set("b", []byte("2"))
+	c.Get("a")
+	c.Set("c", []byte("3"))
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used entry not evicted")
+	}
+	if v, ok := c.Get("a"); !ok || string(v) != "1" || c.Len() != 2 {
+		t.Error("recently used entry evicted")
+	}
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("entry not deleted")
+	}
+}
@@ -1,7 +1,6 @@
 package whttp
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
 	"net"
@@ -19,57 +18,118 @@ const (
 	netTimeout          = 30
 )
 
-func common(ctx context.Context, method, path, body string, header http.Header, timeout uint64,
-	params map[string]string) (response *http.Response, err error) {
-	client := getClientConfig(timeout)
-	req, err := http.NewRequest(method, buildUrl(path, params), strings.NewReader(body))
-	if err != nil {
-		return nil, err
+// defaultClient HttpClient、BalancedClient 未指定 Client 时使用，TLS 校验证书
+var defaultClient, _ = NewClient()
+
+// Client http客户端，所有请求复用同一个 http.Transport 的连接池
+type Client struct {
+	transport *http.Transport
+	timeout   time.Duration // 默认请求超时，0 表示不限制
+	baseURL   string        // path 不带scheme时拼接的前缀
+	header    http.Header   // 默认请求头，请求中未设置时添加
+	retry     *RetryPolicy  // 重试策略，为空时不重试
+
+	base         http.RoundTripper // WithTransport 注入的 transport，为空时使用 transport
+	middlewares  []Middleware
+	roundTripper http.RoundTripper // 中间件包装后的 transport
+}
+
+// NewClient 创建客户端，选项按顺序生效
+func NewClient(opts ...Option) (*Client, error) {
+	c := &Client{
+		transport: newTransport(),
+		header:    make(http.Header),
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
 	}
-	req.Header = header
-	resp, err := client.Do(req.WithContext(ctx))
-	if err != nil {
-		return nil, err
+	base := http.RoundTripper(c.transport)
+	if c.base != nil {
+		base = c.base
 	}
-	response = resp
-	return
+	c.roundTripper = chain(base, c.middlewares)
+	return c, nil
 }
 
-func getClientConfig(timeout uint64) *http.Client {
+func newTransport() *http.Transport {
+	return &http.Transport{
+		TLSClientConfig:   &tls.Config{},
+		DisableKeepAlives: false, // 是否开启http keepalive功能，也即是否重用连接，默认开启(false)
+		Proxy:             http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   netTimeout * time.Second, // 限制建立TCP连接所花费的时间
+			KeepAlive: keepAlive * time.Second,
+		}).DialContext,
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		IdleConnTimeout:     idleConnTimeout * time.Second, // 空闲timeout设置，也即socket在该时间内没有交互则自动关闭连接
+	}
+}
+
+// Transport 获取客户端内置的 http.Transport，使用 WithTransport 时请求不经过它
+func (c *Client) Transport() *http.Transport {
+	return c.transport
+}
+
+// GetHttpClient 获取共享连接池的 http.Client，timeout 单位为秒，0 使用客户端默认超时
+func (c *Client) GetHttpClient(timeout uint64) *http.Client {
+	t := c.timeout
+	if timeout > 0 {
+		t = time.Duration(timeout) * time.Second
+	}
 	return &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-			DisableKeepAlives: false, // 是否开启http keepalive功能，也即是否重用连接，默认开启(false)
-			Proxy:             http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   netTimeout * time.Second, // 限制建立TCP连接所花费的时间
-				KeepAlive: keepAlive * time.Second,
-			}).DialContext,
-			MaxIdleConns:        maxIdleConns,
-			MaxIdleConnsPerHost: maxIdleConnsPerHost,
-			IdleConnTimeout:     idleConnTimeout * time.Second, // 空闲timeout设置，也即socket在该时间内没有交互则自动关闭连接
-		},
-		Timeout: time.Duration(timeout) * time.Second, // 客户端发出的请求的时间限制。该超时包括连接时间、任何、重定向，以及读取响应体
+		Transport: c.roundTripper,
+		Timeout:   t, // 客户端发出的请求的时间限制。该超时包括连接时间、任何、重定向，以及读取响应体
 	}
 }
 
+// Request 发起请求，timeout 单位为秒，0 使用客户端默认超时，配置重试策略时每次重试重放 body
+func (c *Client) Request(ctx context.Context, method, path, body string, header http.Header, timeout uint64,
+	params map[string]string) (response *http.Response, err error) {
+	return c.RequestReader(ctx, method, path, strings.NewReader(body), header, timeout, params)
+}
+
+// Do 发送已构造的请求，补充默认请求头，请求体需设置 GetBody 才会重试
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	req.Header = c.mergeHeader(req.Header)
+	return c.send(c.GetHttpClient(0), req)
+}
+
+// resolve path 不是绝对URL时拼接 baseURL，查询参数中的URL不影响判断
+func (c *Client) resolve(path string) string {
+	if c.baseURL == "" {
+		return path
+	}
+	if u, err := url.Parse(path); err == nil && u.IsAbs() {
+		return path
+	}
+	return strings.TrimSuffix(c.baseURL, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// mergeHeader 复制请求头并补充默认请求头，不修改调用方的 header
+func (c *Client) mergeHeader(header http.Header) http.Header {
+	merged := header.Clone()
+	if merged == nil {
+		merged = make(http.Header, len(c.header))
+	}
+	for key, values := range c.header {
+		if _, ok := merged[key]; !ok {
+			merged[key] = append([]string(nil), values...)
+		}
+	}
+	return merged
+}
+
+// buildUrl 将 params 按key排序合并到 path 已有的查询参数中
 func buildUrl(path string, params map[string]string) string {
 	if len(params) == 0 {
 		return path
 	}
-	if !strings.HasSuffix(path, "?") {
-		path = path + "?"
-	}
-	var buf bytes.Buffer
+	query := make(url.Values, len(params))
 	for key, value := range params {
-		buf.WriteString(url.QueryEscape(key))
-		buf.WriteByte('=')
-		buf.WriteString(url.QueryEscape(value))
-		buf.WriteByte('&')
-	}
-	paramBody := buf.String()
-	if strings.HasSuffix(paramBody, "&") {
-		paramBody = paramBody[:len(paramBody)-1]
+		query.Set(key, value)
 	}
-	return path + paramBody
+	return AppendQuery(path, query)
 }
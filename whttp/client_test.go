@@ -0,0 +1,140 @@
+package whttp
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_ReuseConnection(t *testing.T) {
+	var conns int64
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	ts.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	h := &HttpClient{}
+	for i := 0; i < 5; i++ {
+		code, body, err := h.ResponseBody(context.Background(), http.MethodGet, ts.URL, "", nil, 5, nil)
+		if err != nil || code != http.StatusOK || string(body) != "ok" {
+			t.Fatalf("unexpected response %d %s %v", code, body, err)
+		}
+	}
+	if n := atomic.LoadInt64(&conns); n != 1 {
+		t.Errorf("%d connections opened, expected 1", n)
+	}
+}
+
+func TestClient_TLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	c, _ := NewClient()
+	if _, err := c.Request(context.Background(), http.MethodGet, ts.URL, "", nil, 5, nil); err == nil {
+		t.Fatal("expected certificate verification error")
+	}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	c, err := NewClient(WithCACert(caPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Request(context.Background(), http.MethodGet, ts.URL, "", nil, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// 空的TLS配置之后仍可以追加其他TLS选项
+	c, _ = NewClient(WithTLSConfig(nil), WithInsecureSkipVerify())
+	resp, err = c.Request(context.Background(), http.MethodGet, ts.URL, "", nil, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if _, err = NewClient(WithCACert([]byte("invalid"))); err == nil {
+		t.Error("expected error for invalid CA bundle")
+	}
+	if _, err = NewClient(WithCAFile("/not/exist")); err == nil {
+		t.Error("expected error for missing CA file")
+	}
+}
+
+func TestClient_BaseURLAndHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path + " " + r.Header.Get("X-App") + " " + r.Header.Get("X-Trace")))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(WithBaseURL(ts.URL+"/v1/"), WithHeader("X-App", "demo"), WithHeader("X-Trace", "default"),
+		WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{"X-Trace": []string{"custom"}}
+	code, body, err := NewHttpClient(c).ResponseBody(context.Background(), http.MethodGet, "/users", "", header, 0, nil)
+	if err != nil || code != http.StatusOK {
+		t.Fatal(code, err)
+	}
+	if string(body) != "/v1/users demo custom" {
+		t.Errorf("unexpected body %s", body)
+	}
+	if len(header) != 1 {
+		t.Error("caller's header modified")
+	}
+
+	// 完整URL不拼接前缀
+	resp, err := c.Request(context.Background(), http.MethodGet, ts.URL+"/raw", "", nil, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "/raw demo default" {
+		t.Errorf("unexpected body %s", data)
+	}
+
+	// 查询参数中包含URL时仍拼接前缀
+	resp, err = c.Request(context.Background(), http.MethodGet, "/cb?next=http://x", "", nil, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "/v1/cb demo default" {
+		t.Errorf("unexpected body %s", data)
+	}
+}
+
+func TestClient_Proxy(t *testing.T) {
+	target := "http://backend.invalid/path"
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.String()))
+	}))
+	defer proxy.Close()
+
+	c, err := NewClient(WithProxy(proxy.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, body, err := NewHttpClient(c).ResponseBody(context.Background(), http.MethodGet, target, "", nil, 5, nil)
+	if err != nil || code != http.StatusOK || string(body) != target {
+		t.Errorf("request not sent through proxy: %d %s %v", code, body, err)
+	}
+	if _, err = NewClient(WithProxy("://bad")); err == nil {
+		t.Error("expected error for invalid proxy")
+	}
+}
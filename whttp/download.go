@@ -2,97 +2,284 @@ package whttp
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/shhnwangjian/toolpkg/cipher"
+)
+
+const (
+	partSuffix      = ".part"      // 下载中的临时文件后缀
+	validatorSuffix = ".validator" // 续传时保存 ETag 或 Last-Modified 的文件后缀
 )
 
+// DownloadOptions 下载选项
+type DownloadOptions struct {
+	Timeout  time.Duration              // 整个下载的超时时间，0 表示不限制
+	Header   http.Header                // 额外的请求头
+	Resume   bool                       // 存在临时文件时使用Range和If-Range续传，失败时保留临时文件
+	MD5      string                     // 期望的MD5（十六进制），为空时不校验
+	SHA256   string                     // 期望的SHA-256（十六进制），为空时不校验
+	Progress func(written, total int64) // 进度回调，total 未知时为-1
+
+	Concurrency  int   // 分段下载的并发数，<=0 时使用默认值
+	ChunkSize    int64 // 分段大小，<=0 时使用默认值
+	ChunkRetries int   // 单个分段失败后的重试次数，<0 时不重试，0 使用默认值
+}
+
 // Download 下载
 func Download(url, writeFile string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("http.Get Error: %s", err.Error())
+	return DownloadFile(context.Background(), url, writeFile, nil)
+}
+
+// DownloadTimeout 下载，超时控制
+func DownloadTimeout(url, writeFile string, timeout int) error {
+	return DownloadFile(context.Background(), url, writeFile, &DownloadOptions{Timeout: time.Duration(timeout) * time.Second})
+}
+
+// DownloadContextTimeout 下载，超时控制
+func DownloadContextTimeout(url, writeFile string, timeout int) error {
+	return DownloadTimeout(url, writeFile, timeout)
+}
+
+// DownloadFile 使用默认客户端下载，见 Client.Download
+func DownloadFile(ctx context.Context, url, writeFile string, opts *DownloadOptions) error {
+	return defaultClient.Download(ctx, url, writeFile, opts)
+}
+
+// Download 下载到 writeFile.part 临时文件，校验通过后重命名为 writeFile，
+// 下载失败或校验失败时不会留下不完整的 writeFile
+func (c *Client) Download(ctx context.Context, url, writeFile string, opts *DownloadOptions) error {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf(fmt.Sprint("download failed, response code:", resp.StatusCode))
+	tmp := writeFile + partSuffix
+	if err := c.downloadPart(ctx, url, tmp, opts); err != nil {
+		if !opts.Resume {
+			os.Remove(tmp)
+		}
+		return err
 	}
-	f, err := os.Create(writeFile)
+	return commitDownload(tmp, writeFile, opts)
+}
+
+// downloadPart 下载到临时文件，续传时从临时文件末尾开始请求，并通过 If-Range 确认服务端文件未变化，
+// 没有保存的 ETag 或 Last-Modified 时无法确认，重新下载
+func (c *Client) downloadPart(ctx context.Context, url, tmp string, opts *DownloadOptions) error {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	validator := ""
+	if opts.Resume {
+		if validator = readValidator(tmp); validator != "" {
+			flag = os.O_CREATE | os.O_WRONLY
+		}
+	}
+	f, err := os.OpenFile(tmp, flag, 0644)
 	if err != nil {
-		return fmt.Errorf("os.Create Error, %s", err.Error())
+		return fmt.Errorf("os.OpenFile Error, %s", err.Error())
 	}
-	_, err = io.Copy(f, resp.Body)
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
 	if err != nil {
-		return fmt.Errorf("io.Copy Error, %s", err.Error())
+		return fmt.Errorf("file.Seek Error, %s", err.Error())
 	}
-	return nil
-}
 
-// DownloadTimeout 下载，超时控制
-func DownloadTimeout(url, writeFile string, timeout int) error {
-	client := &http.Client{
-		Timeout: time.Duration(timeout) * time.Second,
-	}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.resolve(url), nil)
 	if err != nil {
 		return fmt.Errorf("http.NewRequest Error: %s", err.Error())
 	}
-
-	resp, err := client.Do(req)
+	for key, values := range opts.Header {
+		req.Header[key] = values
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+	resp, err := c.Do(req)
 	if err != nil {
 		return fmt.Errorf("client.Do Error: %s", err.Error())
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
+	total := int64(-1)
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return fmt.Errorf("download failed, unexpected Content-Range: %s", resp.Header.Get("Content-Range"))
+		}
+		total = size
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// 服务端文件长度与临时文件一致时已完整，交由校验确认，否则删除临时文件
+		if size := unsatisfiedRangeSize(resp.Header.Get("Content-Range")); size != offset {
+			f.Close()
+			os.Remove(tmp)
+			os.Remove(tmp + validatorSuffix)
+			return fmt.Errorf("download failed, partial file has %d bytes, remote size %d", offset, size)
+		}
+		if opts.Progress != nil {
+			opts.Progress(offset, offset)
+		}
+		return nil
+	case resp.StatusCode == http.StatusOK:
+		// 服务端不支持Range或文件已变化时重新下载
+		if offset > 0 {
+			if err = f.Truncate(0); err != nil {
+				return fmt.Errorf("file.Truncate Error, %s", err.Error())
+			}
+			if _, err = f.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("file.Seek Error, %s", err.Error())
+			}
+			offset = 0
+		}
+		if resp.ContentLength >= 0 {
+			total = resp.ContentLength
+		}
+	default:
 		return fmt.Errorf(fmt.Sprint("download failed, response code:", resp.StatusCode))
 	}
-	f, err := os.Create(writeFile)
-	if err != nil {
-		return fmt.Errorf("os.Create Error, %s", err.Error())
+
+	if opts.Resume {
+		if err = saveValidator(tmp, resp.Header); err != nil {
+			return err
+		}
 	}
 
-	_, err = io.Copy(f, resp.Body)
-	if err != nil {
+	var w io.Writer = f
+	if opts.Progress != nil {
+		w = &progressWriter{w: f, written: offset, total: total, fn: opts.Progress}
+	}
+	if _, err = io.Copy(w, resp.Body); err != nil {
 		return fmt.Errorf("io.Copy Error, %s", err.Error())
 	}
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("file.Sync Error, %s", err.Error())
+	}
+	return f.Close()
+}
+
+// commitDownload 校验临时文件并重命名，校验失败时删除临时文件和校验值文件
+func commitDownload(tmp, writeFile string, opts *DownloadOptions) error {
+	if err := verifyChecksum(tmp, opts.MD5, opts.SHA256); err != nil {
+		os.Remove(tmp)
+		os.Remove(tmp + validatorSuffix)
+		return err
+	}
+	if err := os.Rename(tmp, writeFile); err != nil {
+		return fmt.Errorf("os.Rename Error, %s", err.Error())
+	}
+	os.Remove(tmp + validatorSuffix)
 	return nil
 }
 
-// DownloadContextTimeout 下载，超时控制
-func DownloadContextTimeout(url, writeFile string, timeout int) error {
-	d := time.Now().Add(time.Duration(timeout) * time.Second) // deadline max
-	ctx, cancel := context.WithDeadline(context.Background(), d)
-	defer cancel()
+// rangeValidator If-Range 使用的校验值，优先使用强ETag，其次使用 Last-Modified
+func rangeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
 
-	req, err := http.NewRequest("GET", url, nil)
+// readValidator 读取临时文件对应的校验值，不存在时为空
+func readValidator(tmp string) string {
+	data, err := ioutil.ReadFile(tmp + validatorSuffix)
 	if err != nil {
-		return fmt.Errorf("http.NewRequest Error: %s", err.Error())
+		return ""
 	}
-	req = req.WithContext(ctx)
+	return strings.TrimSpace(string(data))
+}
 
-	client := &http.Client{}
+// saveValidator 保存响应的校验值，响应没有校验值时删除旧的校验值，下次不再续传
+func saveValidator(tmp string, header http.Header) error {
+	validator := rangeValidator(header)
+	if validator == "" {
+		os.Remove(tmp + validatorSuffix)
+		return nil
+	}
+	if err := ioutil.WriteFile(tmp+validatorSuffix, []byte(validator), 0644); err != nil {
+		return fmt.Errorf("ioutil.WriteFile Error, %s", err.Error())
+	}
+	return nil
+}
 
-	resp, err := client.Do(req)
+// verifyChecksum 一次读取同时计算MD5和SHA-256
+func verifyChecksum(path, md5sum, sha256sum string) error {
+	if md5sum == "" && sha256sum == "" {
+		return nil
+	}
+	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("client.Do Error: %s", err.Error())
+		return fmt.Errorf("os.Open Error, %s", err.Error())
 	}
-	defer resp.Body.Close()
+	defer f.Close()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf(fmt.Sprint("download failed, response code:", resp.StatusCode))
+	sha := sha256.New()
+	sum, err := cipher.BytesMD5(io.TeeReader(f, sha))
+	if err != nil {
+		return fmt.Errorf("cipher.BytesMD5 Error, %s", err.Error())
+	}
+	if md5sum != "" && !strings.EqualFold(sum, md5sum) {
+		return fmt.Errorf("md5 mismatch, expected %s, got %s", md5sum, sum)
+	}
+	if sum = fmt.Sprintf("%x", sha.Sum(nil)); sha256sum != "" && !strings.EqualFold(sum, sha256sum) {
+		return fmt.Errorf("sha256 mismatch, expected %s, got %s", sha256sum, sum)
+	}
+	return nil
+}
+
+// parseContentRange 解析 bytes start-end/size，size 未知时为-1
+func parseContentRange(value string) (start, size int64, ok bool) {
+	value = strings.TrimPrefix(value, "bytes ")
+	i, j := strings.IndexByte(value, '-'), strings.IndexByte(value, '/')
+	if i <= 0 || j < i {
+		return 0, 0, false
 	}
-	f, err := os.Create(writeFile)
+	start, err := strconv.ParseInt(value[:i], 10, 64)
 	if err != nil {
-		return fmt.Errorf("os.Create Error, %s", err.Error())
+		return 0, 0, false
 	}
+	if value[j+1:] == "*" {
+		return start, -1, true
+	}
+	size, err = strconv.ParseInt(value[j+1:], 10, 64)
+	return start, size, err == nil
+}
 
-	_, err = io.Copy(f, resp.Body)
+// unsatisfiedRangeSize 解析416响应的 bytes */size，无法解析时为-1
+func unsatisfiedRangeSize(value string) int64 {
+	if !strings.HasPrefix(value, "bytes */") {
+		return -1
+	}
+	size, err := strconv.ParseInt(strings.TrimPrefix(value, "bytes */"), 10, 64)
 	if err != nil {
-		return fmt.Errorf("io.Copy Error, %s", err.Error())
+		return -1
 	}
-	return nil
+	return size
+}
+
+// progressWriter 写入时回调下载进度
+type progressWriter struct {
+	w       io.Writer
+	written int64
+	total   int64
+	fn      func(written, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	p.fn(p.written, p.total)
+	return n, err
 }
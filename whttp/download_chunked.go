@@ -0,0 +1,254 @@
+package whttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shhnwangjian/toolpkg/semaphore"
+)
+
+const (
+	defaultConcurrency  = 4
+	defaultChunkSize    = 8 << 20 // 8MB
+	defaultChunkRetries = 3
+)
+
+// errRemoteChanged 分段下载过程中服务端文件已变化，重试无法恢复
+var errRemoteChanged = errors.New("download failed, remote file changed")
+
+// DownloadChunked 使用默认客户端分段下载，见 Client.DownloadChunked
+func DownloadChunked(ctx context.Context, url, writeFile string, opts *DownloadOptions) error {
+	return defaultClient.DownloadChunked(ctx, url, writeFile, opts)
+}
+
+// DownloadChunked 分段并发下载，先通过HEAD请求获取 Accept-Ranges 和 Content-Length，
+// 预分配临时文件后并发下载各分段，失败的分段单独重试；服务端不支持Range时退化为单连接下载。
+// 分段下载不支持续传，opts.Resume 仅在退化为单连接下载时生效
+func (c *Client) DownloadChunked(ctx context.Context, url, writeFile string, opts *DownloadOptions) error {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	size, validator, ok := c.probeRanges(ctx, url, opts.Header)
+	if !ok {
+		single := *opts
+		single.Timeout = 0
+		return c.Download(ctx, url, writeFile, &single)
+	}
+
+	tmp := writeFile + partSuffix
+	src := &rangeSource{url: url, size: size, validator: validator, header: opts.Header}
+	if err := c.downloadChunks(ctx, src, tmp, opts); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return commitDownload(tmp, writeFile, opts)
+}
+
+// probeRanges 服务端支持Range且长度已知时返回文件大小和 If-Range 使用的 ETag 或 Last-Modified
+func (c *Client) probeRanges(ctx context.Context, url string, header http.Header) (int64, string, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.resolve(url), nil)
+	if err != nil {
+		return 0, "", false
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, "", false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength <= 0 ||
+		!strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes") {
+		return 0, "", false
+	}
+	return resp.ContentLength, rangeValidator(resp.Header), true
+}
+
+// downloadChunks 预分配文件并发下载各分段，任一分段重试后仍失败时取消其余分段
+func (c *Client) downloadChunks(ctx context.Context, src *rangeSource, tmp string, opts *DownloadOptions) error {
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile Error, %s", err.Error())
+	}
+	defer f.Close()
+	if err = f.Truncate(src.size); err != nil {
+		return fmt.Errorf("file.Truncate Error, %s", err.Error())
+	}
+
+	concurrency, chunkSize := opts.Concurrency, opts.ChunkSize
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		progress = newChunkProgress(src.size, opts.Progress)
+		sem      = semaphore.New(concurrency)
+	)
+	for start := int64(0); start < src.size; start += chunkSize {
+		if err = sem.Acquire(ctx, 1); err != nil {
+			break
+		}
+		end := start + chunkSize - 1
+		if end >= src.size {
+			end = src.size - 1
+		}
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+			defer sem.Release(1)
+			if err := c.downloadChunk(ctx, src, f, start, end, opts.ChunkRetries, progress); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("file.Sync Error, %s", err.Error())
+	}
+	return f.Close()
+}
+
+// downloadChunk 下载 [start, end] 分段，失败后从已写入的位置继续请求
+func (c *Client) downloadChunk(ctx context.Context, src *rangeSource, f *os.File, start, end int64,
+	retries int, progress *chunkProgress) error {
+	if retries == 0 {
+		retries = defaultChunkRetries
+	}
+	for attempt := 1; ; attempt++ {
+		n, err := c.fetchRange(ctx, src, f, start, end, progress)
+		start += n
+		if err == nil || ctx.Err() != nil || attempt > retries || errors.Is(err, errRemoteChanged) {
+			return err
+		}
+		wait, _ := DefaultRetryPolicy.backoff(attempt, nil)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// fetchRange 请求 [start, end] 并写入文件对应位置，返回写入的字节数，
+// 通过 If-Range 和 Content-Range 中的总长度确认各分段来自同一文件
+func (c *Client) fetchRange(ctx context.Context, src *rangeSource, f *os.File, start, end int64,
+	progress *chunkProgress) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.resolve(src.url), nil)
+	if err != nil {
+		return 0, fmt.Errorf("http.NewRequest Error: %s", err.Error())
+	}
+	for key, values := range src.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	if src.validator != "" {
+		req.Header.Set("If-Range", src.validator)
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("client.Do Error: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK && src.validator != "" {
+		return 0, errRemoteChanged
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf(fmt.Sprint("download failed, response code:", resp.StatusCode))
+	}
+	s, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	if !ok || s != start {
+		return 0, fmt.Errorf("download failed, unexpected Content-Range: %s", resp.Header.Get("Content-Range"))
+	}
+	if size != src.size {
+		return 0, fmt.Errorf("%w, size %d, expected %d", errRemoteChanged, size, src.size)
+	}
+
+	w := &offsetWriter{f: f, offset: start, progress: progress}
+	n, err := io.Copy(w, io.LimitReader(resp.Body, end-start+1))
+	if err != nil {
+		return n, fmt.Errorf("io.Copy Error, %s", err.Error())
+	}
+	if n != end-start+1 {
+		return n, fmt.Errorf("download failed, range %d-%d short read %d bytes", start, end, n)
+	}
+	return n, nil
+}
+
+// rangeSource 分段下载的文件，各分段使用相同的长度和校验值
+type rangeSource struct {
+	url       string
+	size      int64
+	validator string // HEAD 响应的 ETag 或 Last-Modified，为空时不发送 If-Range
+	header    http.Header
+}
+
+// offsetWriter 从指定位置顺序写入文件
+type offsetWriter struct {
+	f        *os.File
+	offset   int64
+	progress *chunkProgress
+}
+
+func (w *offsetWriter) Write(b []byte) (int, error) {
+	n, err := w.f.WriteAt(b, w.offset)
+	w.offset += int64(n)
+	w.progress.add(int64(n))
+	return n, err
+}
+
+// chunkProgress 汇总各分段的进度，回调串行执行
+type chunkProgress struct {
+	lock    sync.Mutex
+	written int64
+	total   int64
+	fn      func(written, total int64)
+}
+
+func newChunkProgress(total int64, fn func(written, total int64)) *chunkProgress {
+	return &chunkProgress{total: total, fn: fn}
+}
+
+func (p *chunkProgress) add(n int64) {
+	if p.fn == nil || n == 0 {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.written += n
+	p.fn(p.written, p.total)
+}
@@ -0,0 +1,164 @@
+package whttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloadChunked(t *testing.T) {
+	content := make([]byte, 100000)
+	rand.Read(content)
+	var (
+		lock      sync.Mutex
+		ranges    = make(map[string]int)
+		inflight  int64
+		peak      int64
+		failFirst int64 = 1
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&inflight, 1)
+		defer atomic.AddInt64(&inflight, -1)
+		for {
+			p := atomic.LoadInt64(&peak)
+			if n <= p || atomic.CompareAndSwapInt64(&peak, p, n) {
+				break
+			}
+		}
+		lock.Lock()
+		ranges[r.Header.Get("Range")]++
+		lock.Unlock()
+		// 第一个分段首次请求只返回部分数据
+		if r.Header.Get("Range") == "bytes=0-9999" && atomic.CompareAndSwapInt64(&failFirst, 1, 0) {
+			w.Header().Set("Content-Range", "bytes 0-9999/100000")
+			w.Header().Set("Content-Length", "10000")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[:100])
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	var written, total int64
+	dst := filepath.Join(t.TempDir(), "file")
+	err := DownloadChunked(context.Background(), ts.URL, dst, &DownloadOptions{
+		Concurrency: 3,
+		ChunkSize:   10000,
+		SHA256:      fmt.Sprintf("%x", sha256.Sum256(content)),
+		Progress: func(w, t int64) {
+			written, total = w, t
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(dst); !bytes.Equal(data, content) {
+		t.Fatal("content mismatch")
+	}
+	if written != int64(len(content)) || total != int64(len(content)) {
+		t.Errorf("unexpected progress %d/%d", written, total)
+	}
+	if ranges["bytes=0-9999"] != 1 || ranges["bytes=100-9999"] != 1 {
+		t.Errorf("failed segment not resumed, %v", ranges)
+	}
+	if len(ranges) != 12 || ranges[""] != 1 {
+		t.Errorf("unexpected requests %v", ranges)
+	}
+	if peak > 3 {
+		t.Errorf("%d concurrent requests, limit 3", peak)
+	}
+}
+
+func TestDownloadChunked_Fallback(t *testing.T) {
+	content := []byte("no range support")
+	var gets int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt64(&gets, 1)
+		}
+		_, _ = w.Write(content)
+	}))
+	defer ts.Close()
+
+	dst := filepath.Join(t.TempDir(), "file")
+	if err := DownloadChunked(context.Background(), ts.URL, dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(dst); !bytes.Equal(data, content) || gets != 1 {
+		t.Errorf("unexpected result %q %d", data, gets)
+	}
+}
+
+func TestDownloadChunked_SegmentFailure(t *testing.T) {
+	content := make([]byte, 1000)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=500-999" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dst := filepath.Join(t.TempDir(), "file")
+	err := DownloadChunked(context.Background(), ts.URL, dst, &DownloadOptions{ChunkSize: 500, ChunkRetries: -1})
+	if err == nil {
+		t.Fatal("expected segment error")
+	}
+	if matches, _ := filepath.Glob(dst + "*"); len(matches) != 0 {
+		t.Errorf("files left behind %v", matches)
+	}
+}
+
+func TestDownloadChunked_RemoteChanged(t *testing.T) {
+	var (
+		gets     int64
+		ifRanges sync.Map
+	)
+	// HEAD 之后文件被替换，ETag 和长度都发生变化
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, etag := make([]byte, 1000), `"v1"`
+		if r.Method == http.MethodGet {
+			atomic.AddInt64(&gets, 1)
+			ifRanges.Store(r.Header.Get("If-Range"), true)
+			content, etag = make([]byte, 2000), `"v2"`
+		}
+		if r.URL.Path != "/noetag" {
+			w.Header().Set("ETag", etag)
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	for _, path := range []string{"/etag", "/noetag"} {
+		gets = 0
+		dst := filepath.Join(t.TempDir(), "file")
+		err := DownloadChunked(context.Background(), ts.URL+path, dst, &DownloadOptions{ChunkSize: 500, Concurrency: 1})
+		if !errors.Is(err, errRemoteChanged) {
+			t.Fatalf("%s: expected remote changed error, got %v", path, err)
+		}
+		// 文件已变化时不重试
+		if gets != 1 {
+			t.Errorf("%s: %d range requests", path, gets)
+		}
+		if matches, _ := filepath.Glob(dst + "*"); len(matches) != 0 {
+			t.Errorf("files left behind %v", matches)
+		}
+	}
+	if _, ok := ifRanges.Load(`"v1"`); !ok {
+		t.Error("If-Range not sent")
+	}
+}
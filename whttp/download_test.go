@@ -0,0 +1,190 @@
+package whttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newDownloadServer(content []byte, ranges *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ranges != nil {
+			*ranges = append(*ranges, r.Header.Get("Range"))
+		}
+		if r.URL.Path == "/norange" {
+			r.Header.Del("Range")
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+}
+
+func TestDownload(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 10000))
+	ts := newDownloadServer(content, nil)
+	defer ts.Close()
+	dir := t.TempDir()
+
+	var written, total int64
+	dst := filepath.Join(dir, "file")
+	err := DownloadFile(context.Background(), ts.URL, dst, &DownloadOptions{
+		MD5:    fmt.Sprintf("%x", md5.Sum(content)),
+		SHA256: fmt.Sprintf("%X", sha256.Sum256(content)),
+		Progress: func(w, t int64) {
+			written, total = w, t
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(dst); !bytes.Equal(data, content) {
+		t.Error("content mismatch")
+	}
+	if written != int64(len(content)) || total != int64(len(content)) {
+		t.Errorf("unexpected progress %d/%d", written, total)
+	}
+	if _, err = os.Stat(dst + partSuffix); !os.IsNotExist(err) {
+		t.Error("temp file not removed")
+	}
+
+	// 校验失败时不留下目标文件和临时文件
+	bad := filepath.Join(dir, "bad")
+	if err = DownloadFile(context.Background(), ts.URL, bad, &DownloadOptions{MD5: "00"}); err == nil {
+		t.Fatal("expected checksum error")
+	}
+	for _, path := range []string{bad, bad + partSuffix} {
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s should not exist", path)
+		}
+	}
+
+	legacy := filepath.Join(dir, "legacy")
+	if err = Download(ts.URL, legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err = DownloadTimeout(ts.URL, legacy, 5); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(legacy); !bytes.Equal(data, content) {
+		t.Error("content mismatch")
+	}
+}
+
+func TestDownload_Resume(t *testing.T) {
+	content := []byte(strings.Repeat("abcdefghij", 1000))
+	var ranges []string
+	ts := newDownloadServer(content, &ranges)
+	defer ts.Close()
+	dir := t.TempDir()
+	opts := &DownloadOptions{Resume: true, SHA256: fmt.Sprintf("%x", sha256.Sum256(content))}
+
+	for _, path := range []string{"/file", "/norange"} {
+		dst := filepath.Join(dir, path)
+		if err := ioutil.WriteFile(dst+partSuffix, content[:4000], 0644); err != nil {
+			t.Fatal(err)
+		}
+		_ = ioutil.WriteFile(dst+partSuffix+validatorSuffix, []byte(`"v1"`), 0644)
+		ranges = nil
+		if err := DownloadFile(context.Background(), ts.URL+path, dst, opts); err != nil {
+			t.Fatal(err)
+		}
+		if len(ranges) != 1 || ranges[0] != "bytes=4000-" {
+			t.Errorf("unexpected range requests %v", ranges)
+		}
+		if data, _ := ioutil.ReadFile(dst); !bytes.Equal(data, content) {
+			t.Errorf("%s content mismatch", path)
+		}
+		if _, err := os.Stat(dst + partSuffix + validatorSuffix); !os.IsNotExist(err) {
+			t.Error("validator file not removed")
+		}
+	}
+
+	// 服务端文件已变化时 If-Range 不匹配，返回完整内容；没有保存校验值时不续传
+	for name, validator := range map[string]string{"changed": `"v0"`, "unknown": ""} {
+		dst := filepath.Join(dir, name)
+		_ = ioutil.WriteFile(dst+partSuffix, []byte(strings.Repeat("x", 4000)), 0644)
+		if validator != "" {
+			_ = ioutil.WriteFile(dst+partSuffix+validatorSuffix, []byte(validator), 0644)
+		}
+		if err := DownloadFile(context.Background(), ts.URL, dst, opts); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if data, _ := ioutil.ReadFile(dst); !bytes.Equal(data, content) {
+			t.Errorf("%s content mismatch", name)
+		}
+	}
+
+	// 续传后校验失败时删除临时文件和校验值文件
+	bad := filepath.Join(dir, "bad")
+	_ = ioutil.WriteFile(bad+partSuffix, content[:4000], 0644)
+	_ = ioutil.WriteFile(bad+partSuffix+validatorSuffix, []byte(`"v1"`), 0644)
+	if err := DownloadFile(context.Background(), ts.URL, bad, &DownloadOptions{Resume: true, MD5: "00"}); err == nil {
+		t.Fatal("expected checksum error")
+	}
+	for _, path := range []string{bad, bad + partSuffix, bad + partSuffix + validatorSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s should not exist", path)
+		}
+	}
+
+	// 临时文件已完整
+	dst := filepath.Join(dir, "complete")
+	_ = ioutil.WriteFile(dst+partSuffix, content, 0644)
+	_ = ioutil.WriteFile(dst+partSuffix+validatorSuffix, []byte(`"v1"`), 0644)
+	if err := DownloadFile(context.Background(), ts.URL, dst, opts); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(dst); !bytes.Equal(data, content) {
+		t.Error("content mismatch")
+	}
+
+	// 临时文件比服务端文件长时返回416，删除临时文件
+	dst = filepath.Join(dir, "longer")
+	_ = ioutil.WriteFile(dst+partSuffix, append(content, 'x'), 0644)
+	_ = ioutil.WriteFile(dst+partSuffix+validatorSuffix, []byte(`"v1"`), 0644)
+	if err := DownloadFile(context.Background(), ts.URL, dst, opts); err == nil {
+		t.Fatal("expected error for mismatched partial file")
+	}
+	for _, path := range []string{dst, dst + partSuffix, dst + partSuffix + validatorSuffix} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s should not exist", path)
+		}
+	}
+}
+
+func TestDownload_KeepPartOnFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte("partial"))
+	}))
+	defer ts.Close()
+	dir := t.TempDir()
+
+	dst := filepath.Join(dir, "file")
+	if err := DownloadFile(context.Background(), ts.URL, dst, &DownloadOptions{Resume: true}); err == nil {
+		t.Fatal("expected error for truncated body")
+	}
+	if data, _ := ioutil.ReadFile(dst + partSuffix); string(data) != "partial" {
+		t.Errorf("temp file not kept, got %q", data)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Error("target file should not exist")
+	}
+
+	if err := DownloadFile(context.Background(), ts.URL, dst, nil); err == nil {
+		t.Fatal("expected error for truncated body")
+	}
+	if _, err := os.Stat(dst + partSuffix); !os.IsNotExist(err) {
+		t.Error("temp file should be removed")
+	}
+}
@@ -0,0 +1,101 @@
+package whttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+const (
+	maxErrorBody = 4096 // StatusError 保留的响应体上限
+)
+
+// StatusError 响应码不是2xx时返回的错误
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte // 响应体，超过 4KB 时截断
+	Truncated  bool   // 响应体是否被截断
+}
+
+func (e *StatusError) Error() string {
+	if len(e.Body) == 0 {
+		return fmt.Sprintf("unexpected response status %s", e.Status)
+	}
+	return fmt.Sprintf("unexpected response status %s, body: %s", e.Status, e.Body)
+}
+
+// Decode 将响应体按JSON解析，用于读取服务端返回的错误信息
+func (e *StatusError) Decode(v interface{}) error {
+	return json.Unmarshal(e.Body, v)
+}
+
+// newStatusError 读取截断后的响应体，并丢弃不超过 maxDrainBytes 的剩余部分，以便复用连接
+func newStatusError(response *http.Response) *StatusError {
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxErrorBody+1))
+	_, _ = io.CopyN(ioutil.Discard, response.Body, maxDrainBytes)
+	e := &StatusError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		Header:     response.Header,
+		Body:       body,
+	}
+	if len(body) > maxErrorBody {
+		e.Body, e.Truncated = body[:maxErrorBody], true
+	}
+	return e
+}
+
+// DoJSON 使用默认客户端发起JSON请求
+func DoJSON(ctx context.Context, method, url string, in, out interface{}) error {
+	return defaultClient.DoJSON(ctx, method, url, in, out)
+}
+
+// DoJSON in 不为空时编码为JSON请求体，2xx 响应体解析到 out，out 为空时丢弃响应体，
+// 其它响应码返回 *StatusError
+func (c *Client) DoJSON(ctx context.Context, method, url string, in, out interface{}) error {
+	var body io.Reader = http.NoBody
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("json.Marshal Error, %s", err.Error())
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.resolve(url), body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	response, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return newStatusError(response)
+	}
+	if out == nil || response.StatusCode == http.StatusNoContent {
+		_, _ = io.Copy(ioutil.Discard, response.Body)
+		return nil
+	}
+	if err = json.NewDecoder(response.Body).Decode(out); err != nil && err != io.EOF {
+		return fmt.Errorf("json.Decode Error, %s", err.Error())
+	}
+	return nil
+}
+
+// DoJSON 发起JSON请求，见 Client.DoJSON
+func (h *HttpClient) DoJSON(ctx context.Context, method, url string, in, out interface{}) error {
+	return h.client().DoJSON(ctx, method, url, in, out)
+}
@@ -0,0 +1,92 @@
+package whttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestDoJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users":
+			if r.Header.Get("Content-Type") != "application/json" {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			var u testUser
+			_ = json.NewDecoder(r.Body).Decode(&u)
+			u.ID = 7
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(u)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/large":
+			w.Header().Set("X-Error", "large")
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(strings.Repeat("x", maxErrorBody*2)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"user not found"}`))
+		}
+	}))
+	defer ts.Close()
+
+	var out testUser
+	if err := DoJSON(context.Background(), http.MethodPost, ts.URL+"/users", testUser{Name: "bob"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != 7 || out.Name != "bob" {
+		t.Errorf("unexpected output %+v", out)
+	}
+
+	c, _ := NewClient(WithBaseURL(ts.URL))
+	if err := NewHttpClient(c).DoJSON(context.Background(), http.MethodDelete, "/empty", nil, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	err := c.DoJSON(context.Background(), http.MethodGet, "/users/1", nil, &out)
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusNotFound || se.Truncated {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var msg struct {
+		Message string `json:"message"`
+	}
+	if err = se.Decode(&msg); err != nil || msg.Message != "user not found" {
+		t.Errorf("unexpected error body %s %v", se.Body, err)
+	}
+
+	err = c.DoJSON(context.Background(), http.MethodGet, "/large", nil, nil)
+	if !errors.As(err, &se) || !se.Truncated || len(se.Body) != maxErrorBody || se.Header.Get("X-Error") != "large" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestNewStatusError_Drain(t *testing.T) {
+	// 超过 StatusError 保留长度的部分被丢弃，以便复用连接，丢弃的长度有上限
+	for _, extra := range []int{100, maxDrainBytes * 2} {
+		r := strings.NewReader(strings.Repeat("x", maxErrorBody+extra))
+		e := newStatusError(&http.Response{StatusCode: http.StatusBadGateway, Body: ioutil.NopCloser(r)})
+		if !e.Truncated || len(e.Body) != maxErrorBody {
+			t.Fatalf("unexpected error body %d", len(e.Body))
+		}
+		expected := extra - 1 - maxDrainBytes
+		if expected < 0 {
+			expected = 0
+		}
+		if r.Len() != expected {
+			t.Errorf("%d bytes left, extra %d", r.Len(), extra)
+		}
+	}
+}
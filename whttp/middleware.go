@@ -0,0 +1,147 @@
+package whttp
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/shhnwangjian/toolpkg/lib"
+)
+
+const (
+	HeaderRequestID = "X-Request-Id"
+)
+
+// Middleware 包装 http.RoundTripper，在请求发出前和收到响应后插入逻辑，如鉴权、日志、指标
+// 实现中不能修改传入的请求，需要修改时先 Clone
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc 函数形式的 http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithMiddleware 添加中间件，先添加的在外层，最先处理请求、最后处理响应，重试时每次尝试都会经过中间件
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(c *Client) error {
+		c.middlewares = append(c.middlewares, middlewares...)
+		return nil
+	}
+}
+
+// chain 按添加顺序由外到内包装 transport
+func chain(transport http.RoundTripper, middlewares []Middleware) http.RoundTripper {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		transport = middlewares[i](transport)
+	}
+	return transport
+}
+
+// BeforeRequest 请求发出前回调，fn 收到请求的副本，可以修改请求头，返回错误时不发出请求
+func BeforeRequest(fn func(req *http.Request) error) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			if err := fn(req); err != nil {
+				return nil, err
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// AfterResponse 收到响应或请求失败后回调，elapsed 为本次请求耗时，不含读取响应体的时间
+func AfterResponse(fn func(req *http.Request, response *http.Response, err error, elapsed time.Duration)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			response, err := next.RoundTrip(req)
+			fn(req, response, err, time.Since(start))
+			return response, err
+		})
+	}
+}
+
+// BearerAuth 设置 Authorization: Bearer 请求头，请求中已设置时不覆盖
+func BearerAuth(token string) Middleware {
+	return BeforeRequest(func(req *http.Request) error {
+		if req.Header.Get("Authorization") == "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return nil
+	})
+}
+
+// BasicAuth 设置 Authorization: Basic 请求头，请求中已设置时不覆盖
+func BasicAuth(username, password string) Middleware {
+	return BeforeRequest(func(req *http.Request) error {
+		if req.Header.Get("Authorization") == "" {
+			req.SetBasicAuth(username, password)
+		}
+		return nil
+	})
+}
+
+// RequestID 请求中未设置 header 时使用 lib.GenReqID 生成请求ID，header 为空时使用 X-Request-Id
+func RequestID(header string) Middleware {
+	if header == "" {
+		header = HeaderRequestID
+	}
+	return BeforeRequest(func(req *http.Request) error {
+		if req.Header.Get(header) == "" {
+			req.Header.Set(header, lib.GenReqID())
+		}
+		return nil
+	})
+}
+
+// AccessLogEntry 一次请求的访问日志
+type AccessLogEntry struct {
+	Time      time.Time
+	Method    string
+	URL       string
+	RequestID string
+	Status    int // 请求失败时为0
+	Elapsed   time.Duration
+	Err       error
+}
+
+// String key=value 格式
+func (e AccessLogEntry) String() string {
+	s := fmt.Sprintf("time=%s method=%s url=%q request_id=%s status=%d elapsed=%s",
+		e.Time.Format(time.RFC3339Nano), e.Method, e.URL, e.RequestID, e.Status, e.Elapsed)
+	if e.Err != nil {
+		s += fmt.Sprintf(" error=%q", e.Err.Error())
+	}
+	return s
+}
+
+// AccessLog 访问日志，fn 为空时使用标准库 log 输出，请求ID取自 header，header 为空时使用 X-Request-Id，
+// 需在 RequestID 之后添加并使用相同的 header
+func AccessLog(header string, fn func(entry AccessLogEntry)) Middleware {
+	if header == "" {
+		header = HeaderRequestID
+	}
+	if fn == nil {
+		fn = func(entry AccessLogEntry) {
+			log.Println(entry.String())
+		}
+	}
+	return AfterResponse(func(req *http.Request, response *http.Response, err error, elapsed time.Duration) {
+		entry := AccessLogEntry{
+			Time:      time.Now().Add(-elapsed),
+			Method:    req.Method,
+			URL:       req.URL.Redacted(),
+			RequestID: req.Header.Get(header),
+			Elapsed:   elapsed,
+			Err:       err,
+		}
+		if response != nil {
+			entry.Status = response.StatusCode
+		}
+		fn(entry)
+	})
+}
@@ -0,0 +1,125 @@
+package whttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddleware_Order(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("X-Trace")))
+	}))
+	defer ts.Close()
+
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, "before "+name)
+				req = req.Clone(req.Context())
+				req.Header.Add("X-Trace", name)
+				response, err := next.RoundTrip(req)
+				order = append(order, "after "+name)
+				return response, err
+			})
+		}
+	}
+	c, _ := NewClient(WithMiddleware(trace("a"), trace("b")))
+	header := http.Header{}
+	code, body, err := NewHttpClient(c).ResponseBody(context.Background(), http.MethodGet, ts.URL, "", header, 5, nil)
+	if err != nil || code != http.StatusOK || string(body) != "a" {
+		t.Fatalf("unexpected response %d %s %v", code, body, err)
+	}
+	if strings.Join(order, ",") != "before a,before b,after b,after a" {
+		t.Errorf("unexpected order %v", order)
+	}
+	if len(header) != 0 {
+		t.Error("caller's header modified")
+	}
+}
+
+func TestMiddleware_BuiltIn(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HeaderRequestID) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer ts.Close()
+
+	var entries []AccessLogEntry
+	c, _ := NewClient(WithMiddleware(RequestID(""), AccessLog("", func(entry AccessLogEntry) {
+		entries = append(entries, entry)
+	}), BearerAuth("token")))
+	h := NewHttpClient(c)
+	_, body, err := h.ResponseBody(context.Background(), http.MethodGet, ts.URL+"/a", "", nil, 5, nil)
+	if err != nil || string(body) != "Bearer token" {
+		t.Fatalf("unexpected response %s %v", body, err)
+	}
+	_, body, _ = h.ResponseBody(context.Background(), http.MethodGet, ts.URL, "", http.Header{"Authorization": []string{"custom"}}, 5, nil)
+	if string(body) != "custom" {
+		t.Errorf("Authorization overwritten: %s", body)
+	}
+	if len(entries) != 2 || entries[0].Status != http.StatusOK || entries[0].Method != http.MethodGet ||
+		entries[0].URL != ts.URL+"/a" || entries[0].RequestID == "" || entries[0].RequestID == entries[1].RequestID {
+		t.Errorf("unexpected access log %v", entries)
+	}
+
+	// 自定义请求ID的请求头
+	entries = nil
+	c, _ = NewClient(WithMiddleware(RequestID("X-Trace-Id"), AccessLog("X-Trace-Id", func(entry AccessLogEntry) {
+		entries = append(entries, entry)
+	})))
+	_, _, _ = NewHttpClient(c).ResponseBody(context.Background(), http.MethodGet, ts.URL+"/a", "", nil, 5, nil)
+	if len(entries) != 1 || entries[0].RequestID == "" {
+		t.Errorf("trace id not logged %v", entries)
+	}
+
+	c, _ = NewClient(WithMiddleware(RequestID(""), BasicAuth("user", "pass")))
+	_, body, _ = NewHttpClient(c).ResponseBody(context.Background(), http.MethodGet, ts.URL, "", nil, 5, nil)
+	if string(body) != "Basic dXNlcjpwYXNz" {
+		t.Errorf("unexpected Authorization %s", body)
+	}
+}
+
+func TestMiddleware_Hooks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	denied := errors.New("denied")
+	var status int
+	var elapsed time.Duration
+	c, _ := NewClient(WithMiddleware(
+		AfterResponse(func(req *http.Request, response *http.Response, err error, d time.Duration) {
+			if response != nil {
+				status = response.StatusCode
+			}
+			elapsed = d
+		}),
+		BeforeRequest(func(req *http.Request) error {
+			if req.URL.Path == "/deny" {
+				return denied
+			}
+			return nil
+		}),
+	))
+	if _, err := c.Request(context.Background(), http.MethodGet, ts.URL+"/deny", "", nil, 5, nil); !errors.Is(err, denied) {
+		t.Errorf("expected denied error, got %v", err)
+	}
+	resp, err := c.Request(context.Background(), http.MethodGet, ts.URL, "", nil, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if status != http.StatusAccepted || elapsed <= 0 {
+		t.Errorf("unexpected hook result %d %v", status, elapsed)
+	}
+}
@@ -29,32 +29,46 @@ type IHttpClient interface {
 	GetHttpClient(timeout uint64) *http.Client
 }
 
+// HttpClient IHttpClient 的实现，Client 为空时使用默认客户端
 type HttpClient struct {
+	Client *Client
+}
+
+// NewHttpClient 基于指定客户端创建 IHttpClient
+func NewHttpClient(c *Client) *HttpClient {
+	return &HttpClient{Client: c}
+}
+
+func (h *HttpClient) client() *Client {
+	if h.Client != nil {
+		return h.Client
+	}
+	return defaultClient
 }
 
 func (h *HttpClient) Get(ctx context.Context, path, body string, header http.Header, timeout uint64,
 	params map[string]string) (response *http.Response, err error) {
-	return common(ctx, http.MethodGet, path, body, header, timeout, params)
+	return h.client().Request(ctx, http.MethodGet, path, body, header, timeout, params)
 }
 
 func (h *HttpClient) Post(ctx context.Context, path, body string, header http.Header, timeout uint64,
 	params map[string]string) (response *http.Response, err error) {
-	return common(ctx, http.MethodPost, path, body, header, timeout, params)
+	return h.client().Request(ctx, http.MethodPost, path, body, header, timeout, params)
 }
 
 func (h *HttpClient) Put(ctx context.Context, path, body string, header http.Header, timeout uint64,
 	params map[string]string) (response *http.Response, err error) {
-	return common(ctx, http.MethodPut, path, body, header, timeout, params)
+	return h.client().Request(ctx, http.MethodPut, path, body, header, timeout, params)
 }
 
 func (h *HttpClient) Delete(ctx context.Context, path, body string, header http.Header, timeout uint64,
 	params map[string]string) (response *http.Response, err error) {
-	return common(ctx, http.MethodDelete, path, body, header, timeout, params)
+	return h.client().Request(ctx, http.MethodDelete, path, body, header, timeout, params)
 }
 
 func (h *HttpClient) Patch(ctx context.Context, path, body string, header http.Header, timeout uint64,
 	params map[string]string) (response *http.Response, err error) {
-	return common(ctx, http.MethodPatch, path, body, header, timeout, params)
+	return h.client().Request(ctx, http.MethodPatch, path, body, header, timeout, params)
 }
 
 func (h *HttpClient) Request(ctx context.Context, method, path, body string, header http.Header, timeout uint64,
@@ -71,7 +85,7 @@ func (h *HttpClient) Request(ctx context.Context, method, path, body string, hea
 	case http.MethodDelete:
 		return h.Delete(ctx, path, body, header, timeout, params)
 	case http.MethodOptions, http.MethodTrace, http.MethodHead, http.MethodConnect:
-		return common(ctx, method, path, body, header, timeout, params)
+		return h.client().Request(ctx, method, path, body, header, timeout, params)
 	default:
 		return nil, fmt.Errorf("%s-%s", method, noDefineMethod)
 	}
@@ -89,5 +103,5 @@ func (h *HttpClient) ResponseBody(ctx context.Context, method, path, body string
 }
 
 func (h *HttpClient) GetHttpClient(timeout uint64) *http.Client {
-	return getClientConfig(timeout)
+	return h.client().GetHttpClient(timeout)
 }
@@ -0,0 +1,132 @@
+package whttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Option 客户端选项
+type Option func(c *Client) error
+
+// WithTimeout 默认请求超时，包括连接、重定向以及读取响应体
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) error {
+		c.timeout = timeout
+		return nil
+	}
+}
+
+// WithTransport 使用指定的 http.RoundTripper 发送请求，如测试用的 Recorder，
+// TLS、代理等选项只作用于内置的 http.Transport，对注入的 transport 无效
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) error {
+		c.base = transport
+		return nil
+	}
+}
+
+// WithTLSConfig 替换TLS配置，为空时使用默认配置
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *Client) error {
+		if config == nil {
+			config = &tls.Config{}
+		}
+		c.transport.TLSClientConfig = config.Clone()
+		return nil
+	}
+}
+
+// WithCAFile 使用PEM格式的CA证书文件校验服务端证书
+func WithCAFile(path string) Option {
+	return func(c *Client) error {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("ioutil.ReadFile Error, %s", err.Error())
+		}
+		return WithCACert(data)(c)
+	}
+}
+
+// WithCACert 使用PEM格式的CA证书校验服务端证书
+func WithCACert(pem []byte) Option {
+	return func(c *Client) error {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no valid certificate found in CA bundle")
+		}
+		c.transport.TLSClientConfig.RootCAs = pool
+		return nil
+	}
+}
+
+// WithClientCert 双向认证使用的客户端证书和私钥文件
+func WithClientCert(certFile, keyFile string) Option {
+	return func(c *Client) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("tls.LoadX509KeyPair Error, %s", err.Error())
+		}
+		c.transport.TLSClientConfig.Certificates = append(c.transport.TLSClientConfig.Certificates, cert)
+		return nil
+	}
+}
+
+// WithInsecureSkipVerify 不校验服务端证书，仅用于测试或自签名证书的内部服务
+func WithInsecureSkipVerify() Option {
+	return func(c *Client) error {
+		c.transport.TLSClientConfig.InsecureSkipVerify = true
+		return nil
+	}
+}
+
+// WithProxy 使用指定代理，为空时不使用代理，默认读取环境变量
+func WithProxy(proxy string) Option {
+	return func(c *Client) error {
+		if proxy == "" {
+			c.transport.Proxy = nil
+			return nil
+		}
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return fmt.Errorf("url.Parse Error, %s", err.Error())
+		}
+		c.transport.Proxy = http.ProxyURL(u)
+		return nil
+	}
+}
+
+// WithBaseURL path 不带scheme时拼接的前缀，如 http://api.example.com/v1
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) error {
+		if _, err := url.Parse(baseURL); err != nil {
+			return fmt.Errorf("url.Parse Error, %s", err.Error())
+		}
+		c.baseURL = baseURL
+		return nil
+	}
+}
+
+// WithHeader 添加默认请求头，请求中已设置的请求头不会被覆盖
+func WithHeader(key, value string) Option {
+	return func(c *Client) error {
+		c.header.Add(key, value)
+		return nil
+	}
+}
+
+// WithHeaders 添加多个默认请求头
+func WithHeaders(header http.Header) Option {
+	return func(c *Client) error {
+		for key, values := range header {
+			for _, value := range values {
+				c.header.Add(key, value)
+			}
+		}
+		return nil
+	}
+}
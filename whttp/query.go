@@ -0,0 +1,66 @@
+package whttp
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// AppendQuery 将 query 合并到 rawURL 已有的查询参数中，相同的key追加值，
+// 合并后按key排序编码，相同的参数总是生成相同的URL，便于签名和缓存
+func AppendQuery(rawURL string, query url.Values) string {
+	if len(query) == 0 {
+		return rawURL
+	}
+	fragment := ""
+	if i := strings.IndexByte(rawURL, '#'); i >= 0 {
+		rawURL, fragment = rawURL[:i], rawURL[i:]
+	}
+	base, rawQuery := rawURL, ""
+	if i := strings.IndexByte(rawURL, '?'); i >= 0 {
+		base, rawQuery = rawURL[:i], rawURL[i+1:]
+	}
+
+	merged, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// 已有的查询参数无法解析时保持原样，只追加新参数
+		return base + "?" + rawQuery + "&" + query.Encode() + fragment
+	}
+	for key, values := range query {
+		merged[key] = append(merged[key], values...)
+	}
+	return base + "?" + merged.Encode() + fragment
+}
+
+// ExpandPath 展开路径模板，如 /v1/users/{id}，变量值按路径段转义，缺少变量时返回错误
+func ExpandPath(template string, vars map[string]string) (string, error) {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			b.WriteString(template)
+			return b.String(), nil
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unclosed variable in path template: %s", template)
+		}
+		name := template[start+1 : start+end]
+		value, ok := vars[name]
+		if !ok {
+			return "", fmt.Errorf("missing path variable: %s", name)
+		}
+		b.WriteString(template[:start])
+		b.WriteString(url.PathEscape(value))
+		template = template[start+end+1:]
+	}
+}
+
+// BuildURL 展开路径模板并合并查询参数
+func BuildURL(template string, vars map[string]string, query url.Values) (string, error) {
+	path, err := ExpandPath(template, vars)
+	if err != nil {
+		return "", err
+	}
+	return AppendQuery(path, query), nil
+}
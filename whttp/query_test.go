@@ -0,0 +1,63 @@
+package whttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestAppendQuery(t *testing.T) {
+	for _, c := range []struct {
+		url      string
+		query    url.Values
+		expected string
+	}{
+		{"http://a/b", nil, "http://a/b"},
+		{"http://a/b", url.Values{"tag": {"x", "y"}, "id": {"1"}}, "http://a/b?id=1&tag=x&tag=y"},
+		{"http://a/b?", url.Values{"q": {"a b"}}, "http://a/b?q=a+b"},
+		{"http://a/b?z=1&tag=w", url.Values{"tag": {"x"}}, "http://a/b?tag=w&tag=x&z=1"},
+		{"http://a/b?k=v#frag", url.Values{"a": {"&"}}, "http://a/b?a=%26&k=v#frag"},
+		{"/b?bad=%zz", url.Values{"a": {"1"}}, "/b?bad=%zz&a=1"},
+	} {
+		if got := AppendQuery(c.url, c.query); got != c.expected {
+			t.Errorf("AppendQuery(%s) = %s, expected %s", c.url, got, c.expected)
+		}
+	}
+
+	params := map[string]string{"b": "2", "a": "1", "c": "3"}
+	for i := 0; i < 10; i++ {
+		if got := buildUrl("/path?x=0", params); got != "/path?a=1&b=2&c=3&x=0" {
+			t.Fatalf("unexpected url %s", got)
+		}
+	}
+}
+
+func TestBuildURL(t *testing.T) {
+	got, err := BuildURL("/v1/users/{id}/files/{name}", map[string]string{"id": "42", "name": "a b/c?"},
+		url.Values{"tag": {"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "/v1/users/42/files/a%20b%2Fc%3F?tag=a&tag=b" {
+		t.Errorf("unexpected url %s", got)
+	}
+	if _, err = ExpandPath("/v1/users/{id}", nil); err == nil {
+		t.Error("expected missing variable error")
+	}
+	if _, err = ExpandPath("/v1/users/{id", map[string]string{"id": "1"}); err == nil {
+		t.Error("expected unclosed variable error")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.EscapedPath() + "?" + r.URL.RawQuery))
+	}))
+	defer ts.Close()
+	path, _ := BuildURL(ts.URL+"/v1/users/{id}", map[string]string{"id": "a/b"}, url.Values{"tag": {"x", "y"}})
+	_, body, err := (&HttpClient{}).ResponseBody(context.Background(), http.MethodGet, path, "", nil, 5,
+		map[string]string{"page": "2"})
+	if err != nil || string(body) != "/v1/users/a%2Fb?page=2&tag=x&tag=y" {
+		t.Errorf("unexpected response %s %v", body, err)
+	}
+}
@@ -0,0 +1,248 @@
+package whttp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// RecordMode Recorder 的工作模式
+type RecordMode int
+
+const (
+	ModeReplay RecordMode = iota // 只回放golden文件中的请求，不访问网络
+	ModeRecord                   // 发送真实请求并记录，Save 时覆盖golden文件
+)
+
+// ErrNoInteraction 回放时没有匹配的记录
+var ErrNoInteraction = errors.New("no recorded interaction matched")
+
+// RecordedRequest 记录的请求
+type RecordedRequest struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 bool        `json:"body_base64,omitempty"` // 非UTF-8内容以base64保存
+}
+
+// RecordedResponse 记录的响应
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 bool        `json:"body_base64,omitempty"`
+}
+
+// Interaction 一次请求和响应
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// Matcher 判断请求与记录的请求是否匹配，body 为请求体
+type Matcher func(req *http.Request, body []byte, recorded *RecordedRequest) bool
+
+// MatchMethod 请求方法相同
+func MatchMethod(req *http.Request, body []byte, recorded *RecordedRequest) bool {
+	return req.Method == recorded.Method
+}
+
+// MatchURL 完整URL相同
+func MatchURL(req *http.Request, body []byte, recorded *RecordedRequest) bool {
+	return req.URL.String() == recorded.URL
+}
+
+// MatchBody 请求体相同
+func MatchBody(req *http.Request, body []byte, recorded *RecordedRequest) bool {
+	data, err := decodeBody(recorded.Body, recorded.BodyBase64)
+	return err == nil && bytes.Equal(body, data)
+}
+
+// MatchAll 所有 matcher 都匹配
+func MatchAll(matchers ...Matcher) Matcher {
+	return func(req *http.Request, body []byte, recorded *RecordedRequest) bool {
+		for _, m := range matchers {
+			if !m(req, body, recorded) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Recorder 记录和回放请求的 http.RoundTripper，配合 WithTransport 使用，
+// 记录模式下将真实的请求和响应保存到golden文件，回放模式下按 Matcher 从golden文件中返回响应
+type Recorder struct {
+	Path          string            // golden文件路径
+	Mode          RecordMode        // 工作模式
+	Transport     http.RoundTripper // 记录模式下发送真实请求，为空时使用 http.DefaultTransport
+	Matcher       Matcher           // 回放时的匹配规则，为空时匹配方法、URL和请求体
+	RedactHeaders []string          // 记录时不保存的请求头，如 Authorization
+
+	lock         sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewRecorder 创建 Recorder，回放模式下读取golden文件
+func NewRecorder(path string, mode RecordMode) (*Recorder, error) {
+	r := &Recorder{Path: path, Mode: mode, RedactHeaders: []string{"Authorization", HeaderSignature}}
+	if mode != ModeReplay {
+		return r, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile Error, %s", err.Error())
+	}
+	if err = json.Unmarshal(data, &r.interactions); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal Error, %s", err.Error())
+	}
+	r.used = make([]bool, len(r.interactions))
+	return r, nil
+}
+
+// Interactions 已记录或已加载的请求数量
+func (r *Recorder) Interactions() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.interactions)
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.GetBody == nil && req.Body != nil && req.Body != http.NoBody {
+		// 读取请求体时会替换 Body，不能修改调用方的请求
+		req = req.Clone(req.Context())
+	}
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.Mode == ModeRecord {
+		return r.record(req, body)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return r.replay(req, body)
+}
+
+// replay 优先返回未使用过的匹配记录，相同请求多次记录时按顺序回放，用完后重复最后一条
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	matcher := r.Matcher
+	if matcher == nil {
+		matcher = MatchAll(MatchMethod, MatchURL, MatchBody)
+	}
+
+	r.lock.Lock()
+	found := -1
+	for i, it := range r.interactions {
+		if !matcher(req, body, &it.Request) {
+			continue
+		}
+		found = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if found < 0 {
+		r.lock.Unlock()
+		return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL.String())
+	}
+	r.used[found] = true
+	recorded := r.interactions[found].Response
+	r.lock.Unlock()
+
+	data, err := decodeBody(recorded.Body, recorded.BodyBase64)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(recorded.StatusCode) + " " + http.StatusText(recorded.StatusCode),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
+
+// record 发送真实请求，读取完整的响应体后记录
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	response, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll Error, %s", err.Error())
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	it := &Interaction{
+		Request:  RecordedRequest{Method: req.Method, URL: req.URL.String(), Header: req.Header.Clone()},
+		Response: RecordedResponse{StatusCode: response.StatusCode, Header: response.Header.Clone()},
+	}
+	for _, name := range r.RedactHeaders {
+		it.Request.Header.Del(name)
+	}
+	it.Request.Body, it.Request.BodyBase64 = encodeBody(body)
+	it.Response.Body, it.Response.BodyBase64 = encodeBody(data)
+
+	r.lock.Lock()
+	r.interactions = append(r.interactions, it)
+	r.used = append(r.used, true)
+	r.lock.Unlock()
+	return response, nil
+}
+
+// Save 记录模式下将记录写入golden文件
+func (r *Recorder) Save() error {
+	if r.Mode != ModeRecord {
+		return nil
+	}
+	r.lock.Lock()
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	r.lock.Unlock()
+	if err != nil {
+		return fmt.Errorf("json.Marshal Error, %s", err.Error())
+	}
+	if err = os.MkdirAll(filepath.Dir(r.Path), 0755); err != nil {
+		return fmt.Errorf("os.MkdirAll Error, %s", err.Error())
+	}
+	if err = ioutil.WriteFile(r.Path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("ioutil.WriteFile Error, %s", err.Error())
+	}
+	return nil
+}
+
+func encodeBody(data []byte) (string, bool) {
+	if utf8.Valid(data) {
+		return string(data), false
+	}
+	return base64.StdEncoding.EncodeToString(data), true
+}
+
+func decodeBody(body string, isBase64 bool) ([]byte, error) {
+	if !isBase64 {
+		return []byte(body), nil
+	}
+	return base64.StdEncoding.DecodeString(body)
+}
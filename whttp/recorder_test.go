@@ -0,0 +1,114 @@
+package whttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Call", fmt.Sprint(calls))
+		if r.URL.Path == "/binary" {
+			_, _ = w.Write([]byte{0xff, 0x00, 0xfe})
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%s %s %s %d", r.Method, r.URL.Path, body, calls)
+	}))
+	golden := filepath.Join(t.TempDir(), "testdata", "users.json")
+
+	// 记录
+	rec, _ := NewRecorder(golden, ModeRecord)
+	c, _ := NewClient(WithTransport(rec), WithHeader("Authorization", "Bearer secret"))
+	h := NewHttpClient(c)
+	var recorded []string
+	for _, body := range []string{"a", "b", "a"} {
+		_, data, err := h.ResponseBody(context.Background(), http.MethodPost, ts.URL+"/users", body, nil, 5, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded = append(recorded, string(data))
+	}
+	_, binary, err := h.ResponseBody(context.Background(), http.MethodGet, ts.URL+"/binary", "", nil, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	ts.Close()
+	if data, _ := ioutil.ReadFile(golden); strings.Contains(string(data), "secret") {
+		t.Error("Authorization header recorded")
+	}
+
+	// 离线回放
+	rep, err := NewRecorder(golden, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Interactions() != 4 {
+		t.Fatalf("%d interactions loaded", rep.Interactions())
+	}
+	c, _ = NewClient(WithTransport(rep))
+	h = NewHttpClient(c)
+	for i, body := range []string{"a", "b", "a", "a"} {
+		code, data, err := h.ResponseBody(context.Background(), http.MethodPost, ts.URL+"/users", body, nil, 5, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 相同请求按记录顺序回放，用完后重复最后一条
+		expected := recorded[i%3]
+		if i == 3 {
+			expected = recorded[2]
+		}
+		if code != http.StatusCreated || string(data) != expected {
+			t.Errorf("replay %d: unexpected response %d %s, expected %s", i, code, data, expected)
+		}
+	}
+	_, data, err := h.ResponseBody(context.Background(), http.MethodGet, ts.URL+"/binary", "", nil, 5, nil)
+	if err != nil || string(data) != string(binary) {
+		t.Errorf("binary body not replayed, %v %v", data, err)
+	}
+	if _, err = h.Post(context.Background(), ts.URL+"/users", "c", nil, 5, nil); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("expected no interaction error, got %v", err)
+	}
+
+	// 自定义匹配规则忽略请求体
+	rep, _ = NewRecorder(golden, ModeReplay)
+	rep.Matcher = MatchAll(MatchMethod, MatchURL)
+	c, _ = NewClient(WithTransport(rep))
+	if _, data, err = NewHttpClient(c).ResponseBody(context.Background(), http.MethodPost, ts.URL+"/users", "c", nil,
+		5, nil); err != nil || string(data) != recorded[0] {
+		t.Errorf("unexpected response %s %v", data, err)
+	}
+
+	if _, err = NewRecorder(filepath.Join(t.TempDir(), "missing.json"), ModeReplay); err == nil {
+		t.Error("expected error for missing golden file")
+	}
+}
+
+func TestWithTransport(t *testing.T) {
+	c, _ := NewClient(WithTransport(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusTeapot,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader(req.Header.Get("X-App"))),
+			Request:    req,
+		}, nil
+	})), WithHeader("X-App", "stub"), WithMiddleware(RequestID("")))
+	code, body, err := NewHttpClient(c).ResponseBody(context.Background(), http.MethodGet, "http://stub.invalid/", "",
+		nil, 5, nil)
+	if err != nil || code != http.StatusTeapot || string(body) != "stub" {
+		t.Errorf("unexpected response %d %s %v", code, body, err)
+	}
+}
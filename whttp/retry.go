@@ -0,0 +1,170 @@
+package whttp
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	maxDrainBytes = 4096 // 重试前读取并丢弃的响应体上限，便于复用连接
+)
+
+// RetryPolicy 重试策略，每次尝试单独计算请求超时
+type RetryPolicy struct {
+	MaxAttempts        int           // 最大尝试次数，包括首次请求，<=1 时不重试
+	BaseDelay          time.Duration // 首次重试前的等待时间，之后每次翻倍
+	MaxDelay           time.Duration // 单次等待上限，Retry-After 超过上限时不再重试，0 表示不限制
+	StatusCodes        []int         // 需要重试的响应码，为空时使用 429/502/503/504
+	RetryNonIdempotent bool          // 是否重试 POST、PATCH 等非幂等方法
+}
+
+// DefaultRetryPolicy 默认重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+var defaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// WithRetry 设置重试策略
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) error {
+		c.retry = &policy
+		return nil
+	}
+}
+
+type retryableKey struct{}
+
+// WithRetryable 声明请求可以安全重试，非幂等方法也会按重试策略重试
+func WithRetryable(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryableKey{}, true)
+}
+
+// retryable 幂等方法、携带 Idempotency-Key 或调用方声明可重试的请求才重试，请求体需能重放
+func (p *RetryPolicy) retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if p.RetryNonIdempotent || isIdempotent(req.Method) || req.Header.Get("Idempotency-Key") != "" {
+		return true
+	}
+	ok, _ := req.Context().Value(retryableKey{}).(bool)
+	return ok
+}
+
+// shouldRetry 网络错误或响应码在重试列表中时重试
+func (p *RetryPolicy) shouldRetry(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	codes := p.StatusCodes
+	if len(codes) == 0 {
+		codes = defaultRetryStatusCodes
+	}
+	for _, code := range codes {
+		if response.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 第attempt次失败后的等待时间，优先使用 Retry-After，否则指数退避并加入随机抖动
+func (p *RetryPolicy) backoff(attempt int, response *http.Response) (time.Duration, bool) {
+	if response != nil {
+		if d, ok := retryAfter(response.Header.Get("Retry-After")); ok {
+			if p.MaxDelay > 0 && d > p.MaxDelay {
+				return 0, false
+			}
+			return d, true
+		}
+	}
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0, true
+	}
+	// 保留一半的等待时间，另一半随机，避免多个客户端同时重试
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)), true
+}
+
+// retryAfter 解析 Retry-After，支持秒数和HTTP日期两种格式
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	d := time.Until(t)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+// send 发送请求，失败时按重试策略重放请求体重试
+func (c *Client) send(client *http.Client, req *http.Request) (*http.Response, error) {
+	p := c.retry
+	if p == nil || p.MaxAttempts <= 1 || !p.retryable(req) {
+		return client.Do(req)
+	}
+
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		response, err := client.Do(req)
+		if attempt >= p.MaxAttempts || ctx.Err() != nil || !p.shouldRetry(response, err) {
+			return response, err
+		}
+		wait, ok := p.backoff(attempt, response)
+		if !ok {
+			return response, err
+		}
+		if response != nil {
+			_, _ = io.CopyN(ioutil.Discard, response.Body, maxDrainBytes)
+			response.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		next := req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			next.Body = body
+		}
+		req = next
+	}
+}
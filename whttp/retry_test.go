@@ -0,0 +1,143 @@
+package whttp
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newFlakyServer(failures int64, code int, calls *int64, bodies chan<- string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		if bodies != nil {
+			bodies <- string(data)
+		}
+		if atomic.AddInt64(calls, 1) <= failures {
+			w.WriteHeader(code)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+}
+
+func newRetryClient(t *testing.T) *HttpClient {
+	c, err := NewClient(WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHttpClient(c)
+}
+
+func TestRetry_StatusCode(t *testing.T) {
+	var calls int64
+	ts := newFlakyServer(2, http.StatusServiceUnavailable, &calls, nil)
+	defer ts.Close()
+
+	code, body, err := newRetryClient(t).ResponseBody(context.Background(), http.MethodGet, ts.URL, "", nil, 5, nil)
+	if err != nil || code != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("unexpected response %d %s %v", code, body, err)
+	}
+	if calls != 3 {
+		t.Errorf("%d calls, expected 3", calls)
+	}
+
+	// 超过最大尝试次数返回最后一次响应
+	calls = 0
+	ts2 := newFlakyServer(5, http.StatusBadGateway, &calls, nil)
+	defer ts2.Close()
+	code, _, err = newRetryClient(t).ResponseBody(context.Background(), http.MethodGet, ts2.URL, "", nil, 5, nil)
+	if err != nil || code != http.StatusBadGateway || calls != 3 {
+		t.Errorf("unexpected result %d %d %v", code, calls, err)
+	}
+
+	// 不在重试列表中的响应码不重试
+	calls = 0
+	ts3 := newFlakyServer(5, http.StatusInternalServerError, &calls, nil)
+	defer ts3.Close()
+	code, _, _ = newRetryClient(t).ResponseBody(context.Background(), http.MethodGet, ts3.URL, "", nil, 5, nil)
+	if code != http.StatusInternalServerError || calls != 1 {
+		t.Errorf("unexpected result %d %d", code, calls)
+	}
+}
+
+func TestRetry_NonIdempotent(t *testing.T) {
+	var calls int64
+	bodies := make(chan string, 10)
+	ts := newFlakyServer(1, http.StatusServiceUnavailable, &calls, bodies)
+	defer ts.Close()
+	h := newRetryClient(t)
+
+	code, _, _ := h.ResponseBody(context.Background(), http.MethodPost, ts.URL, "payload", nil, 5, nil)
+	if code != http.StatusServiceUnavailable || calls != 1 {
+		t.Fatalf("POST should not be retried, %d %d", code, calls)
+	}
+	<-bodies
+
+	calls = 0
+	code, _, _ = h.ResponseBody(WithRetryable(context.Background()), http.MethodPost, ts.URL, "payload", nil, 5, nil)
+	if code != http.StatusOK || calls != 2 {
+		t.Fatalf("opted-in POST should be retried, %d %d", code, calls)
+	}
+	for i := 0; i < 2; i++ {
+		if b := <-bodies; b != "payload" {
+			t.Errorf("body not replayed, got %q", b)
+		}
+	}
+}
+
+func TestRetry_RetryAfter(t *testing.T) {
+	var calls int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer ts.Close()
+
+	// Retry-After 超过等待上限时不再重试
+	code, _, _ := newRetryClient(t).ResponseBody(context.Background(), http.MethodGet, ts.URL, "", nil, 5, nil)
+	if code != http.StatusTooManyRequests || calls != 1 {
+		t.Errorf("unexpected result %d %d", code, calls)
+	}
+
+	if d, ok := retryAfter("2"); !ok || d != 2*time.Second {
+		t.Errorf("unexpected delay %v", d)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if d, ok := retryAfter(date); !ok || d <= 50*time.Second || d > time.Minute {
+		t.Errorf("unexpected delay %v", d)
+	}
+	if _, ok := retryAfter("soon"); ok {
+		t.Error("invalid Retry-After accepted")
+	}
+}
+
+func TestRetry_NetworkError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := ts.URL
+	ts.Close()
+
+	start := time.Now()
+	if _, err := newRetryClient(t).Get(context.Background(), url, "", nil, 5, nil); err == nil {
+		t.Fatal("expected connection error")
+	}
+	if time.Since(start) < time.Millisecond {
+		t.Error("no backoff between attempts")
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		d, ok := p.backoff(attempt+1, nil)
+		if !ok || d < max/2 || d > max {
+			t.Errorf("attempt %d: delay %v not in [%v, %v]", attempt+1, d, max/2, max)
+		}
+	}
+}
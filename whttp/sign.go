@@ -0,0 +1,342 @@
+package whttp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderSignature     = "X-Signature"
+	HeaderTimestamp     = "X-Timestamp"
+	HeaderNonce         = "X-Nonce"
+	HeaderContentSHA256 = "X-Content-Sha256"
+
+	signAlgorithm       = "HMAC-SHA256"
+	defaultMaxSkew      = 5 * time.Minute
+	defaultMaxBodyBytes = 10 << 20 // 10MB
+)
+
+var (
+	ErrSignatureMissing = errors.New("signature missing")          // 缺少签名相关请求头
+	ErrSignatureInvalid = errors.New("signature invalid")          // 签名或请求体摘要不匹配
+	ErrSignatureExpired = errors.New("signature timestamp skewed") // 时间戳超出允许的偏差
+	ErrSignatureReplay  = errors.New("signature nonce replayed")   // nonce 已使用过
+)
+
+// Signer HMAC-SHA256 请求签名，规范请求由方法、路径、排序后的查询参数、指定的请求头、
+// 请求体SHA-256、时间戳和nonce组成，签名写入 X-Signature 请求头：
+//
+//	X-Signature: HMAC-SHA256 KeyId=<id>, SignedHeaders=host;content-type, Signature=<hex>
+type Signer struct {
+	KeyID   string
+	Secret  []byte
+	Headers []string // 参与签名的请求头，如 Host、Content-Type
+
+	now func() time.Time
+}
+
+// NewSigner 创建签名器
+func NewSigner(keyID string, secret []byte, headers ...string) *Signer {
+	return &Signer{KeyID: keyID, Secret: secret, Headers: headers}
+}
+
+// Middleware 对每次请求签名，重试时重新签名
+func (s *Signer) Middleware() Middleware {
+	return BeforeRequest(s.Sign)
+}
+
+// Sign 对请求签名，请求已设置 X-Content-Sha256 时直接使用，否则读取请求体计算摘要，
+// 流式请求体需调用方预先设置摘要，避免整体读入内存
+func (s *Signer) Sign(req *http.Request) error {
+	digest := req.Header.Get(HeaderContentSHA256)
+	if digest == "" {
+		body, err := readBody(req)
+		if err != nil {
+			return err
+		}
+		digest = sha256Hex(body)
+		req.Header.Set(HeaderContentSHA256, digest)
+	}
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now().Unix(), 10))
+	req.Header.Set(HeaderNonce, nonce)
+
+	names := make([]string, 0, len(s.Headers))
+	for _, name := range s.Headers {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	signature := hmacHex(s.Secret, canonicalRequest(req, names, digest))
+	req.Header.Set(HeaderSignature, fmt.Sprintf("%s KeyId=%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, s.KeyID, strings.Join(names, ";"), signature))
+	return nil
+}
+
+// canonicalRequest 规范请求，各部分以换行分隔
+func canonicalRequest(req *http.Request, names []string, digest string) string {
+	var b strings.Builder
+	b.WriteString(req.Method + "\n")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	b.WriteString(path + "\n")
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		b.WriteString(req.URL.RawQuery + "\n")
+	} else {
+		b.WriteString(query.Encode() + "\n")
+	}
+	for _, name := range names {
+		b.WriteString(name + ":" + strings.TrimSpace(headerValue(req, name)) + "\n")
+	}
+	b.WriteString(strings.Join(names, ";") + "\n")
+	b.WriteString(req.Header.Get(HeaderTimestamp) + "\n")
+	b.WriteString(req.Header.Get(HeaderNonce) + "\n")
+	b.WriteString(digest)
+	return b.String()
+}
+
+// headerValue 请求头的值，host 取自 req.Host 或 URL，多个值以逗号连接
+func headerValue(req *http.Request, name string) string {
+	if name == "host" {
+		if req.Host != "" {
+			return req.Host
+		}
+		return req.URL.Host
+	}
+	return strings.Join(req.Header.Values(name), ",")
+}
+
+// readBody 读取请求体并恢复，优先使用 GetBody 避免消耗原请求体
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return ioutil.ReadAll(body)
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll Error, %s", err.Error())
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacHex(secret []byte, data string) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = io.WriteString(mac, data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("rand.Read Error, %s", err.Error())
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NonceCache 记录有效期内使用过的nonce
+type NonceCache interface {
+	// Seen nonce 已使用过时返回 true，否则记录并在 expire 后遗忘
+	Seen(nonce string, expire time.Time) bool
+}
+
+// memoryNonceCache 内存nonce缓存，写入时清理过期的记录
+type memoryNonceCache struct {
+	lock      sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryNonceCache 创建内存nonce缓存
+func NewMemoryNonceCache() NonceCache {
+	return &memoryNonceCache{nonces: make(map[string]time.Time)}
+}
+
+func (c *memoryNonceCache) Seen(nonce string, expire time.Time) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	if now.Sub(c.lastSweep) > time.Minute {
+		for n, e := range c.nonces {
+			if now.After(e) {
+				delete(c.nonces, n)
+			}
+		}
+		c.lastSweep = now
+	}
+	if e, ok := c.nonces[nonce]; ok && now.Before(e) {
+		return true
+	}
+	c.nonces[nonce] = expire
+	return false
+}
+
+// Verifier 服务端验证 Signer 生成的签名
+type Verifier struct {
+	Secrets         func(keyID string) ([]byte, bool) // 按 KeyId 查找密钥
+	MaxSkew         time.Duration                     // 允许的时间偏差，0 使用默认值5分钟
+	Nonces          NonceCache                        // 为空时不检查重放
+	MaxBodyBytes    int64                             // 请求体最大长度，<=0 使用默认值10MB
+	RequiredHeaders []string                          // 必须参与签名的请求头，如 Host、Content-Type
+
+	now func() time.Time
+}
+
+// NewVerifier 使用固定的密钥创建验证器，并使用内存nonce缓存防止重放
+func NewVerifier(secrets map[string][]byte) *Verifier {
+	return &Verifier{
+		Secrets: func(keyID string) ([]byte, bool) {
+			secret, ok := secrets[keyID]
+			return secret, ok
+		},
+		Nonces: NewMemoryNonceCache(),
+	}
+}
+
+// Verify 验证请求签名、请求体摘要、时间戳和nonce，先按请求头中的摘要验证签名，
+// 通过后再读取不超过 MaxBodyBytes 的请求体校验摘要，请求体读取后恢复，不影响后续处理
+func (v *Verifier) Verify(r *http.Request) error {
+	keyID, names, signature, ok := parseSignature(r.Header.Get(HeaderSignature))
+	timestamp, nonce := r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderNonce)
+	digest := r.Header.Get(HeaderContentSHA256)
+	if !ok || timestamp == "" || nonce == "" || digest == "" {
+		return ErrSignatureMissing
+	}
+	for _, name := range v.RequiredHeaders {
+		if !containsString(names, strings.ToLower(name)) {
+			return fmt.Errorf("%w: header %s not signed", ErrSignatureInvalid, name)
+		}
+	}
+	secret, ok := v.Secrets(keyID)
+	if !ok {
+		return fmt.Errorf("%w: unknown key %s", ErrSignatureInvalid, keyID)
+	}
+
+	skew := v.MaxSkew
+	if skew <= 0 {
+		skew = defaultMaxSkew
+	}
+	now := time.Now
+	if v.now != nil {
+		now = v.now
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrSignatureMissing
+	}
+	signedAt := time.Unix(ts, 0)
+	if d := now().Sub(signedAt); d > skew || d < -skew {
+		return ErrSignatureExpired
+	}
+
+	expected := hmacHex(secret, canonicalRequest(r, names, digest))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrSignatureInvalid
+	}
+
+	maxBody := v.MaxBodyBytes
+	if maxBody <= 0 {
+		maxBody = defaultMaxBodyBytes
+	}
+	if r.ContentLength > maxBody {
+		return fmt.Errorf("%w: body exceeds %d bytes", ErrSignatureInvalid, maxBody)
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = http.MaxBytesReader(nil, r.Body, maxBody)
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(sha256Hex(body)), []byte(digest)) {
+		return fmt.Errorf("%w: body digest mismatch", ErrSignatureInvalid)
+	}
+
+	// 签名有效后才记录nonce，避免伪造请求占用nonce
+	if v.Nonces != nil && v.Nonces.Seen(keyID+":"+nonce, signedAt.Add(skew)) {
+		return ErrSignatureReplay
+	}
+	return nil
+}
+
+// Handler 验证失败时返回401，验证通过后调用 next
+func (v *Verifier) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := v.Verify(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSignature 解析 X-Signature 请求头
+func parseSignature(value string) (keyID string, names []string, signature string, ok bool) {
+	if !strings.HasPrefix(value, signAlgorithm+" ") {
+		return "", nil, "", false
+	}
+	var hasHeaders bool
+	for _, part := range strings.Split(strings.TrimPrefix(value, signAlgorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return "", nil, "", false
+		}
+		switch kv[0] {
+		case "KeyId":
+			keyID = kv[1]
+		case "SignedHeaders":
+			hasHeaders = true
+			if kv[1] != "" {
+				names = strings.Split(kv[1], ";")
+			}
+		case "Signature":
+			signature = kv[1]
+		}
+	}
+	return keyID, names, signature, hasHeaders && signature != ""
+}
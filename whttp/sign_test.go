@@ -0,0 +1,156 @@
+package whttp
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigner_Verifier(t *testing.T) {
+	secret := []byte("secret")
+	verifier := NewVerifier(map[string][]byte{"app": secret})
+	ts := httptest.NewServer(verifier.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})))
+	defer ts.Close()
+
+	signer := NewSigner("app", secret, "Host", "Content-Type")
+	c, _ := NewClient(WithMiddleware(signer.Middleware()))
+	h := NewHttpClient(c)
+	header := http.Header{"Content-Type": {"application/json"}}
+	code, body, err := h.ResponseBody(context.Background(), http.MethodPost, ts.URL+"/v1/users",
+		`{"name":"bob"}`, header, 5, map[string]string{"b": "2", "a": "1"})
+	if err != nil || code != http.StatusOK || string(body) != `{"name":"bob"}` {
+		t.Fatalf("unexpected response %d %s %v", code, body, err)
+	}
+	code, _, _ = h.ResponseBody(context.Background(), http.MethodGet, ts.URL, "", nil, 5, nil)
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+
+	// 未签名和密钥错误的请求被拒绝
+	code, _, _ = (&HttpClient{}).ResponseBody(context.Background(), http.MethodGet, ts.URL, "", nil, 5, nil)
+	if code != http.StatusUnauthorized {
+		t.Errorf("unsigned request accepted, %d", code)
+	}
+	c, _ = NewClient(WithMiddleware(NewSigner("app", []byte("wrong")).Middleware()))
+	code, _, _ = NewHttpClient(c).ResponseBody(context.Background(), http.MethodGet, ts.URL, "", nil, 5, nil)
+	if code != http.StatusUnauthorized {
+		t.Errorf("request with wrong secret accepted, %d", code)
+	}
+}
+
+func newSignedRequest(t *testing.T, signer *Signer, body string) *http.Request {
+	req, _ := http.NewRequest(http.MethodPut, "http://api.example.com/v1/items/1?z=1&a=2", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/plain")
+	if err := signer.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟服务端收到的请求
+	server := httptest.NewRequest(req.Method, req.URL.String(), strings.NewReader(body))
+	server.Header = req.Header.Clone()
+	return server
+}
+
+func TestVerifier_Reject(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now()
+	signer := &Signer{KeyID: "app", Secret: secret, Headers: []string{"host", "content-type"}, now: func() time.Time {
+		return now
+	}}
+	verifier := NewVerifier(map[string][]byte{"app": secret})
+
+	req := newSignedRequest(t, signer, "payload")
+	if err := verifier.Verify(req); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadAll(req.Body); string(body) != "payload" {
+		t.Error("body not restored")
+	}
+	req.Body = ioutil.NopCloser(strings.NewReader("payload"))
+	if err := verifier.Verify(req); !errors.Is(err, ErrSignatureReplay) {
+		t.Errorf("expected replay error, got %v", err)
+	}
+
+	req = newSignedRequest(t, signer, "payload")
+	req.Body = ioutil.NopCloser(strings.NewReader("tampered"))
+	if err := verifier.Verify(req); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected invalid body digest, got %v", err)
+	}
+
+	req = newSignedRequest(t, signer, "payload")
+	req.Header.Set("Content-Type", "application/json")
+	if err := verifier.Verify(req); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected invalid signature for modified header, got %v", err)
+	}
+
+	req = newSignedRequest(t, signer, "payload")
+	req.URL.RawQuery = "z=1&a=3"
+	if err := verifier.Verify(req); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected invalid signature for modified query, got %v", err)
+	}
+
+	// 查询参数顺序不影响签名
+	req = newSignedRequest(t, signer, "payload")
+	req.URL.RawQuery = "a=2&z=1"
+	if err := verifier.Verify(req); err != nil {
+		t.Errorf("reordered query rejected, %v", err)
+	}
+
+	req = newSignedRequest(t, signer, "payload")
+	verifier.now = func() time.Time {
+		return now.Add(10 * time.Minute)
+	}
+	if err := verifier.Verify(req); !errors.Is(err, ErrSignatureExpired) {
+		t.Errorf("expected skew error, got %v", err)
+	}
+
+	req.Header.Del(HeaderSignature)
+	if err := verifier.Verify(req); !errors.Is(err, ErrSignatureMissing) {
+		t.Errorf("expected missing signature, got %v", err)
+	}
+}
+
+func TestVerifier_Limits(t *testing.T) {
+	secret := []byte("secret")
+	signer := NewSigner("app", secret, "Host", "Content-Type")
+	verifier := NewVerifier(map[string][]byte{"app": secret})
+	verifier.MaxBodyBytes = 4
+
+	req := newSignedRequest(t, signer, "payload")
+	if err := verifier.Verify(req); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected oversized body rejected, got %v", err)
+	}
+	// 长度未知的请求体读取时限制长度
+	req = newSignedRequest(t, signer, "payload")
+	req.ContentLength = -1
+	if err := verifier.Verify(req); err == nil {
+		t.Error("expected unknown length body over limit rejected")
+	}
+	// 签名无效时不读取请求体
+	req = newSignedRequest(t, signer, "payload")
+	req.Header.Set(HeaderContentSHA256, sha256Hex([]byte("other")))
+	if err := verifier.Verify(req); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected invalid signature, got %v", err)
+	}
+	if body, _ := ioutil.ReadAll(req.Body); string(body) != "payload" {
+		t.Error("body read before signature verified")
+	}
+
+	verifier.MaxBodyBytes = 0
+	verifier.RequiredHeaders = []string{"Host", "X-Tenant"}
+	req = newSignedRequest(t, signer, "payload")
+	if err := verifier.Verify(req); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected unsigned required header rejected, got %v", err)
+	}
+	verifier.RequiredHeaders = []string{"Host", "Content-Type"}
+	if err := verifier.Verify(req); err != nil {
+		t.Errorf("signed required headers rejected, %v", err)
+	}
+}
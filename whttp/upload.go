@@ -0,0 +1,317 @@
+package whttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RequestReader 以 io.Reader 作为请求体发起请求，请求体边读边发送，不会整体读入内存。
+// body 为 *os.File、*bytes.Reader、*strings.Reader 等可获取长度的类型时设置 Content-Length，
+// 否则使用 chunked 编码；无法重放的请求体不会重试
+func (c *Client) RequestReader(ctx context.Context, method, path string, body io.Reader, header http.Header,
+	timeout uint64, params map[string]string) (response *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, method, buildUrl(c.resolve(path), params), body)
+	if err != nil {
+		return nil, err
+	}
+	if req.ContentLength == 0 && body != nil {
+		if size := bodySize(body); size > 0 {
+			req.ContentLength = size
+		}
+	}
+	req.Header = c.mergeHeader(header)
+	return c.send(c.GetHttpClient(timeout), req)
+}
+
+// Upload 以 multipart/form-data 上传，progress 为空时不回调进度，各部分长度已知时设置 Content-Length，
+// 不含 AddReader 添加的部分时请求体可以重放，按重试策略重试
+func (c *Client) Upload(ctx context.Context, url string, m *Multipart, header http.Header,
+	progress func(written, total int64)) (*http.Response, error) {
+	size := m.Size()
+	gate := &progressGate{fn: progress}
+	open := func() (io.ReadCloser, error) {
+		body := m.Reader()
+		if progress == nil {
+			return body, nil
+		}
+		return gate.wrap(body, size), nil
+	}
+	body, _ := open()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.resolve(url), body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	if m.replayable() {
+		req.GetBody = open
+	}
+	req.Header = c.mergeHeader(header)
+	req.Header.Set("Content-Type", m.ContentType())
+	return c.send(c.GetHttpClient(0), req)
+}
+
+// RequestReader 以 io.Reader 作为请求体发起请求，见 Client.RequestReader
+func (h *HttpClient) RequestReader(ctx context.Context, method, path string, body io.Reader, header http.Header,
+	timeout uint64, params map[string]string) (response *http.Response, err error) {
+	return h.client().RequestReader(ctx, method, path, body, header, timeout, params)
+}
+
+// Upload 以 multipart/form-data 上传，见 Client.Upload
+func (h *HttpClient) Upload(ctx context.Context, url string, m *Multipart, header http.Header,
+	progress func(written, total int64)) (*http.Response, error) {
+	return h.client().Upload(ctx, url, m, header, progress)
+}
+
+// bodySize 请求体剩余长度，未知时为-1
+func bodySize(body io.Reader) int64 {
+	switch b := body.(type) {
+	case interface{ Size() int64 }:
+		return b.Size()
+	case *os.File:
+		info, err := b.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		offset, err := b.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return info.Size() - offset
+	}
+	return -1
+}
+
+// ProgressReader 读取时回调进度，用于上传进度
+type ProgressReader struct {
+	r     io.Reader
+	read  int64
+	total int64
+	fn    func(written, total int64)
+}
+
+// NewProgressReader 创建进度回调的 io.Reader，total 未知时传-1
+func NewProgressReader(r io.Reader, total int64, fn func(written, total int64)) *ProgressReader {
+	return &ProgressReader{r: r, total: total, fn: fn}
+}
+
+func (p *ProgressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.read += int64(n)
+		p.fn(p.read, p.total)
+	}
+	return n, err
+}
+
+// Size 总长度，用于设置 Content-Length
+func (p *ProgressReader) Size() int64 {
+	return p.total
+}
+
+// Close 关闭底层的 io.Reader
+func (p *ProgressReader) Close() error {
+	if closer, ok := p.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// progressGate 重试时旧请求体可能仍在被传输层读取，只有当前请求体的进度才回调，回调串行执行
+type progressGate struct {
+	lock    sync.Mutex
+	current int // 当前请求体的序号，关闭后为0
+	seq     int
+	fn      func(written, total int64)
+}
+
+// wrap 新的请求体替换之前的请求体，之前的请求体不再回调进度
+func (g *progressGate) wrap(body io.ReadCloser, total int64) io.ReadCloser {
+	g.lock.Lock()
+	g.seq++
+	id := g.seq
+	g.current = id
+	g.lock.Unlock()
+
+	r := NewProgressReader(body, total, func(written, total int64) {
+		g.lock.Lock()
+		defer g.lock.Unlock()
+		if g.current == id {
+			g.fn(written, total)
+		}
+	})
+	return &gatedBody{ProgressReader: r, close: func() {
+		g.lock.Lock()
+		if g.current == id {
+			g.current = 0
+		}
+		g.lock.Unlock()
+	}}
+}
+
+type gatedBody struct {
+	*ProgressReader
+	close func()
+}
+
+func (b *gatedBody) Close() error {
+	b.close()
+	return b.ProgressReader.Close()
+}
+
+type multipartPart struct {
+	field    string
+	filename string
+	value    string
+	path     string    // 文件路径，发送时才打开
+	reader   io.Reader // 只能读取一次
+	size     int64     // reader 的长度，未知时为-1
+}
+
+// Multipart multipart/form-data 请求体构造器，文件内容在发送时通过 io.Pipe 流式写入，不会整体读入内存
+type Multipart struct {
+	boundary string
+	parts    []multipartPart
+}
+
+// NewMultipart 创建 multipart/form-data 请求体
+func NewMultipart() *Multipart {
+	return &Multipart{boundary: multipart.NewWriter(nil).Boundary()}
+}
+
+// AddField 添加表单字段
+func (m *Multipart) AddField(field, value string) *Multipart {
+	m.parts = append(m.parts, multipartPart{field: field, value: value})
+	return m
+}
+
+// AddFile 添加文件，文件名取路径的最后一部分
+func (m *Multipart) AddFile(field, path string) *Multipart {
+	m.parts = append(m.parts, multipartPart{field: field, filename: filepath.Base(path), path: path})
+	return m
+}
+
+// AddReader 添加 io.Reader 作为文件内容，只能发送一次，size 未知时传-1
+func (m *Multipart) AddReader(field, filename string, r io.Reader, size int64) *Multipart {
+	m.parts = append(m.parts, multipartPart{field: field, filename: filename, reader: r, size: size})
+	return m
+}
+
+// ContentType 带 boundary 的 Content-Type
+func (m *Multipart) ContentType() string {
+	return m.writer(nil).FormDataContentType()
+}
+
+// Size 请求体总长度，存在长度未知的部分时为-1
+func (m *Multipart) Size() int64 {
+	counter := &countWriter{}
+	if err := m.writeTo(counter, false); err != nil {
+		return -1
+	}
+	size := counter.n
+	for _, p := range m.parts {
+		switch {
+		case p.path != "":
+			info, err := os.Stat(p.path)
+			if err != nil {
+				return -1
+			}
+			size += info.Size()
+		case p.reader != nil:
+			if p.size < 0 {
+				return -1
+			}
+			size += p.size
+		default:
+			size += int64(len(p.value))
+		}
+	}
+	return size
+}
+
+// Reader 返回请求体，由后台goroutine边读取文件边写入，读取方关闭后写入结束
+func (m *Multipart) Reader() io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(m.writeTo(pw, true))
+	}()
+	return pr
+}
+
+func (m *Multipart) replayable() bool {
+	for _, p := range m.parts {
+		if p.reader != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Multipart) writer(w io.Writer) *multipart.Writer {
+	mw := multipart.NewWriter(w)
+	_ = mw.SetBoundary(m.boundary)
+	return mw
+}
+
+// writeTo 写入请求体，content 为 false 时只写入分隔符和各部分的头，用于计算长度
+func (m *Multipart) writeTo(w io.Writer, content bool) error {
+	mw := m.writer(w)
+	for _, p := range m.parts {
+		if p.path == "" && p.reader == nil {
+			part, err := mw.CreateFormField(p.field)
+			if err != nil {
+				return err
+			}
+			if content {
+				if _, err = io.WriteString(part, p.value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		part, err := mw.CreateFormFile(p.field, p.filename)
+		if err != nil {
+			return err
+		}
+		if content {
+			if err = p.copyTo(part); err != nil {
+				return err
+			}
+		}
+	}
+	return mw.Close()
+}
+
+func (p *multipartPart) copyTo(w io.Writer) error {
+	r := p.reader
+	if p.path != "" {
+		f, err := os.Open(p.path)
+		if err != nil {
+			return fmt.Errorf("os.Open Error, %s", err.Error())
+		}
+		defer f.Close()
+		r = f
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("io.Copy Error, %s", err.Error())
+	}
+	return nil
+}
+
+// countWriter 只计数不保存
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	w.n += int64(len(b))
+	return len(b), nil
+}
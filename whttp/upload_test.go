@@ -0,0 +1,163 @@
+package whttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newUploadServer(calls *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(calls, 1) == 1 && r.URL.Query().Get("flaky") != "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		reader, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "length=%d", r.ContentLength)
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := ioutil.ReadAll(part)
+			fmt.Fprintf(w, " %s:%s:%x", part.FormName(), part.FileName(), md5.Sum(data))
+		}
+	}))
+}
+
+func TestUpload(t *testing.T) {
+	var calls int64
+	ts := newUploadServer(&calls)
+	defer ts.Close()
+
+	content := make([]byte, 1<<20)
+	rand.Read(content)
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMultipart().AddField("name", "demo").AddFile("file", path)
+	size := m.Size()
+	var (
+		lock           sync.Mutex
+		written, total int64
+	)
+	c, _ := NewClient(WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}))
+	resp, err := c.Upload(WithRetryable(context.Background()), ts.URL+"?flaky=1", m, nil, func(w, t int64) {
+		lock.Lock()
+		defer lock.Unlock()
+		written, total = w, t
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	expected := fmt.Sprintf("length=%d name::%x file:data.bin:%x", size, md5.Sum([]byte("demo")), md5.Sum(content))
+	if string(body) != expected {
+		t.Errorf("unexpected response %s, expected %s", body, expected)
+	}
+	if calls != 2 {
+		t.Errorf("%d calls, expected retry", calls)
+	}
+	lock.Lock()
+	if written != size || total != size {
+		t.Errorf("unexpected progress %d/%d, size %d", written, total, size)
+	}
+	lock.Unlock()
+
+	// 长度未知时使用 chunked 编码
+	m = NewMultipart().AddReader("file", "stream.txt", io.MultiReader(strings.NewReader("stream")), -1)
+	if m.Size() != -1 {
+		t.Error("size should be unknown")
+	}
+	resp, err = NewHttpClient(nil).Upload(context.Background(), ts.URL, m, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != fmt.Sprintf("length=-1 file:stream.txt:%x", md5.Sum([]byte("stream"))) {
+		t.Errorf("unexpected response %s", body)
+	}
+
+	m = NewMultipart().AddFile("file", filepath.Join(t.TempDir(), "missing"))
+	if _, err = c.Upload(context.Background(), ts.URL, m, nil, nil); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestRequestReader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%d %s %s", r.ContentLength, r.URL.RawQuery, data)
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "body")
+	_ = ioutil.WriteFile(path, []byte("file body"), 0644)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	h := &HttpClient{}
+	for body, expected := range map[io.Reader]string{
+		f:                               "9 a=1 file body",
+		bytes.NewBufferString("buffer"): "6 a=1 buffer",
+		io.MultiReader(strings.NewReader("multi")): "-1 a=1 multi",
+	} {
+		resp, err := h.RequestReader(context.Background(), http.MethodPut, ts.URL, body, nil, 5,
+			map[string]string{"a": "1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(data) != expected {
+			t.Errorf("unexpected response %s, expected %s", data, expected)
+		}
+	}
+}
+
+func TestProgressGate(t *testing.T) {
+	var reports []int64
+	g := &progressGate{fn: func(written, total int64) {
+		reports = append(reports, written)
+	}}
+	first := g.wrap(ioutil.NopCloser(strings.NewReader("abc")), 3)
+	buf := make([]byte, 1)
+	_, _ = first.Read(buf)
+	second := g.wrap(ioutil.NopCloser(strings.NewReader("abc")), 3)
+	// 被替换的请求体不再回调
+	_, _ = first.Read(buf)
+	_, _ = second.Read(buf)
+	second.Close()
+	_, _ = second.Read(buf)
+	if len(reports) != 2 || reports[0] != 1 || reports[1] != 1 {
+		t.Errorf("unexpected progress %v", reports)
+	}
+}